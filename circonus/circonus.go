@@ -29,6 +29,20 @@ type TranslateRequestBody struct {
 	Query string `json:"q"`
 }
 
+// Translation is the outcome of translating a graphite query, including any
+// statsd aggregation rewrites applied to the CAQL
+type Translation struct {
+	Input          string          `json:"input"`
+	CAQL           string          `json:"caql"`
+	StatsdRewrites []StatsdRewrite `json:"statsd_rewrites,omitempty"`
+}
+
+// StatsdRewrite records a graphite:find() replaced by HandleStatsdAggregations
+type StatsdRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 //Client is a Circonus client
 type Client struct {
 	GraphiteTranslateURL *url.URL
@@ -107,6 +121,16 @@ func New(host, port, apiToken string, accountId int, debug, removeAggs, directIR
 
 // Translate translates a graphite query into a CAQL query
 func (c *Client) Translate(graphiteQuery string) (string, error) {
+	t, err := c.TranslateDetail(graphiteQuery)
+	if err != nil {
+		return "", err
+	}
+	return t.CAQL, nil
+}
+
+// TranslateDetail translates a graphite query into a CAQL query and reports
+// the statsd aggregation rewrites that were applied
+func (c *Client) TranslateDetail(graphiteQuery string) (*Translation, error) {
 
 	// set up the body for the HTTP request
 	query := strings.Replace(graphiteQuery, " ", "", -1)
@@ -115,7 +139,7 @@ func (c *Client) Translate(graphiteQuery string) (string, error) {
 	}
 	reqBody, err := json.Marshal(t)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// debug
 	if c.Debug {
@@ -125,7 +149,10 @@ func (c *Client) Translate(graphiteQuery string) (string, error) {
 	// execute the translation HTTP query
 	translateResp, err := c.ExecuteTranslation(reqBody)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	translation := &Translation{
+		Input: graphiteQuery,
 	}
 
 	// check for statsd aggregations to replace, if found, replace them and add
@@ -133,10 +160,17 @@ func (c *Client) Translate(graphiteQuery string) (string, error) {
 	if len(c.StatsdAggregations) > 0 {
 		// capture the entire graphite:find because we want to replace it's contents later
 		r := regexp.MustCompile(`(graphite:find\('[^']+'\))`)
-		translateResp.CAQL = r.ReplaceAllStringFunc(translateResp.CAQL, c.HandleStatsdAggregations)
+		translateResp.CAQL = r.ReplaceAllStringFunc(translateResp.CAQL, func(s string) string {
+			replaced := c.HandleStatsdAggregations(s)
+			if replaced != s {
+				translation.StatsdRewrites = append(translation.StatsdRewrites, StatsdRewrite{From: s, To: replaced})
+			}
+			return replaced
+		})
 	}
+	translation.CAQL = translateResp.CAQL
 
-	return translateResp.CAQL, nil
+	return translation, nil
 }
 
 // ExecuteTranslation handles the HTTP request for the translation
@@ -200,9 +234,12 @@ func (c *Client) ExecuteTranslation(b []byte) (*TranslateResponseBody, error) {
 
 func (c *Client) IRONdbFindTags(metricSearchPattern string) ([]gosnowth.FindTagsItem, error) {
 
-	c.IRONdbFindTagsURL.RawQuery = "query=and(__name:[graphite]" + metricSearchPattern + ")"
+	// the client is shared by concurrent translations, so the query goes on
+	// a copy of the URL
+	u := *c.IRONdbFindTagsURL
+	u.RawQuery = "query=and(__name:[graphite]" + metricSearchPattern + ")"
 
-	req, err := http.NewRequest("GET", c.IRONdbFindTagsURL.String(), nil)
+	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating HTTP request: %v", err)
 	}
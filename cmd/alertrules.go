@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/circonus/grafana-ds-convert/grafana"
+	"github.com/circonus/grafana-ds-convert/internal/config"
+	"github.com/circonus/grafana-ds-convert/internal/config/keys"
+	"github.com/circonus/grafana-ds-convert/logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var alertRuleFiles []string
+var alertRuleOut string
+
+var alertRulesCmd = &cobra.Command{
+	Use:   "alert-rules",
+	Short: "Convert Graphite backed unified alerting rules to CAQL",
+	Long: `alert-rules converts Grafana unified alerting rule groups whose queries
+use a Graphite datasource into rules querying the Circonus datasource.
+
+Rules are read from the configured source folder, or from files exported
+from Grafana with -f, and written to the destination folder or to the
+file given with --out.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		offline := len(alertRuleFiles) > 0 && alertRuleOut != ""
+		if !offline {
+			if err := config.Validate(); err != nil {
+				log.Fatalf("error validating config: %v", err)
+			}
+		}
+
+		circ, err := newCirconusClient()
+		if err != nil {
+			log.Fatalf("error connecting to circonus: %v", err)
+		}
+		gclient := grafana.New(grafanaURL(), viper.GetString(keys.GrafanaAPIToken), viper.GetBool(keys.Debug), viper.GetBool(keys.GrafanaNoAlerts), circ)
+		gclient.DryRun = viper.GetBool(keys.GrafanaDryRun)
+		switch onFailure := viper.GetString(keys.GrafanaOnFailure); onFailure {
+		case "":
+		case grafana.FailureKeep, grafana.FailureMixed, grafana.FailureAbort:
+			gclient.OnFailure = onFailure
+		default:
+			log.Fatalf("unknown on_failure policy %q", onFailure)
+		}
+
+		// datasource UIDs come from the config, or are looked up by name and,
+		// for graphite, by type
+		circonusUID := viper.GetString(keys.GrafanaCirconusDatasourceUID)
+		graphiteUIDs := viper.GetStringSlice(keys.GrafanaGraphiteDatasourceUIDs)
+		if circonusUID == "" {
+			if offline {
+				log.Fatalf("circonus_datasource_uid must be set to convert alert rule files offline")
+			}
+			uids, err := gclient.DatasourceUIDs(ctx, []string{viper.GetString(keys.GrafanaCirconusDatasource)})
+			if err != nil {
+				log.Fatalf("error finding Circonus datasource: %v", err)
+			}
+			circonusUID = uids[0]
+		}
+		if len(graphiteUIDs) == 0 {
+			if offline {
+				log.Fatalf("graphite_datasource_uids must be set to convert alert rule files offline")
+			}
+			graphiteUIDs, err = gclient.GraphiteUIDs(ctx, viper.GetStringSlice(keys.GrafanaGraphiteDatasources))
+			if err != nil {
+				log.Fatalf("error finding Graphite datasources: %v", err)
+			}
+			if len(graphiteUIDs) == 0 {
+				log.Fatalf("no Graphite datasource found")
+			}
+		}
+
+		var groups []grafana.AlertRuleGroup
+		if len(alertRuleFiles) > 0 {
+			paths, err := expandInputs(alertRuleFiles)
+			if err != nil {
+				log.Fatalf("Unable to find input files: %v", err)
+			}
+			for _, path := range paths {
+				fileGroups, err := grafana.ReadAlertRuleFile(path)
+				if err != nil {
+					log.Fatalf("%v", err)
+				}
+				groups = append(groups, fileGroups...)
+			}
+		} else {
+			srcFolder, err := gclient.ResolveFolder(ctx, viper.GetString(keys.GrafanaSourceFolder))
+			if err != nil {
+				log.Fatalf("source folder: %v", err)
+			}
+			if groups, err = gclient.AlertRuleGroups(ctx, srcFolder.UID); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+
+		converted, results, err := gclient.ConvertAlertRules(groups, circonusUID, graphiteUIDs)
+		if err != nil {
+			log.Fatalf("error converting alert rules: %v", err)
+		}
+		skipped, failed := 0, 0
+		for _, res := range results {
+			if res.Skipped {
+				skipped++
+			}
+			if len(res.Failures) > 0 {
+				failed++
+			}
+		}
+		logger.Printf(logger.LvlInfo, "Converted %d of %d alert rule(s), %d failed", len(results)-skipped, len(results), failed)
+
+		switch {
+		case viper.GetBool(keys.GrafanaDryRun):
+			logger.PrintMarshal(logger.LvlInfo, "Dry run plan:", results)
+		case alertRuleOut != "":
+			// exported files refer to folders by title
+			if dest := viper.GetString(keys.GrafanaDestFolder); dest != "" {
+				for i := range converted {
+					converted[i].FolderUID = dest
+				}
+			}
+			if err := grafana.WriteAlertRuleFile(alertRuleOut, converted); err != nil {
+				log.Fatalf("%v", err)
+			}
+		default:
+			dstFolder, err := gclient.ResolveFolder(ctx, viper.GetString(keys.GrafanaDestFolder))
+			if err != nil {
+				log.Fatalf("destination folder: %v", err)
+			}
+			if err := gclient.CreateAlertRuleGroups(ctx, converted, dstFolder.UID); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(alertRulesCmd)
+	alertRulesCmd.Flags().StringSliceVarP(&alertRuleFiles, "file", "f", nil, "Take alert rules exported from Grafana as YAML or JSON files or globs (repeatable).")
+	alertRulesCmd.Flags().StringVar(&alertRuleOut, "out", "", "write converted alert rules to this file instead of the Grafana destination folder")
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/grafana"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// fileSummary is the outcome of converting the dashboard in one input file
+type fileSummary struct {
+	Path     string
+	Err      error
+	Failures []string
+	// Written is set once the converted dashboard is written, or in dry-run
+	// mode would be
+	Written bool
+}
+
+// expandInputs turns the -f arguments into a sorted, de-duplicated list of
+// files. Directories contribute every .json file directly inside them and
+// glob patterns are expanded.
+func expandInputs(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			sort.Strings(matches)
+			for _, m := range matches {
+				add(m)
+			}
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", arg, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			add(m)
+		}
+	}
+	return files, nil
+}
+
+// readDashboardFile loads a dashboard from a local .json file
+func readDashboardFile(path string) (grafana.Dashboard, error) {
+	var board grafana.Dashboard
+	boardBytes, err := os.ReadFile(path)
+	if err != nil {
+		return board, fmt.Errorf("unable to read from file: %w", err)
+	}
+	if board, err = grafana.DecodeBoard(boardBytes); err != nil {
+		return board, fmt.Errorf("unable to unmarshal dashboard: %w", err)
+	}
+	board.File = path
+	return board, nil
+}
+
+// convertFiles converts the dashboard in each file independently so that one
+// bad file does not stop the rest of the batch. The dashboards that can be
+// read are converted together, as many at a time as the workers allow.
+func convertFiles(g grafana.Grafana, paths []string, circonusDatasource string, graphiteDatasources []string) ([]*grafana.DashboardResult, []fileSummary) {
+	var summaries []fileSummary
+	var boards []grafana.Dashboard
+	// converted holds the index in summaries of each dashboard read
+	var converted []int
+	var emptyDstFolder sdk.FoundBoard
+	for _, path := range paths {
+		sum := fileSummary{Path: path}
+		board, err := readDashboardFile(path)
+		if err != nil {
+			logger.Printf(logger.LvlError, "Skipping %s: %v", path, err)
+			sum.Err = err
+			summaries = append(summaries, sum)
+			continue
+		}
+		if !g.Selector.MatchLocal(sdk.FoundBoard{UID: board.UID, Title: board.Title, Tags: board.Tags}) {
+			logger.Printf(logger.LvlInfo, "Skipping %s: not selected", path)
+			continue
+		}
+		boards = append(boards, board)
+		converted = append(converted, len(summaries))
+		summaries = append(summaries, sum)
+	}
+	results, err := g.ConvertDashboards(boards, circonusDatasource, emptyDstFolder, graphiteDatasources)
+	// there is one result per dashboard, in the order of the dashboards
+	for i, res := range results {
+		summaries[converted[i]].Failures = append(summaries[converted[i]].Failures, res.Failures...)
+		summaries[converted[i]].Written = res.Written
+	}
+	if err != nil {
+		logger.Printf(logger.LvlError, "Error converting dashboards: %v", err)
+		for _, i := range converted {
+			summaries[i].Err = err
+		}
+	}
+	return results, summaries
+}
+
+// printSummary logs the outcome of every input file and returns the number
+// of files whose converted dashboard was not written
+func printSummary(summaries []fileSummary) int {
+	failed := 0
+	partial := 0
+	for _, sum := range summaries {
+		switch {
+		case sum.Err != nil:
+			failed++
+			logger.Printf(logger.LvlError, "FAILED  %s: %v", sum.Path, sum.Err)
+		case !sum.Written:
+			failed++
+			logger.Printf(logger.LvlError, "FAILED  %s: not written, %d failure(s)", sum.Path, len(sum.Failures))
+			for _, f := range sum.Failures {
+				logger.Printf(logger.LvlError, "        %s", f)
+			}
+		case len(sum.Failures) > 0:
+			partial++
+			logger.Printf(logger.LvlWarning, "PARTIAL %s: %d translation failure(s)", sum.Path, len(sum.Failures))
+			for _, f := range sum.Failures {
+				logger.Printf(logger.LvlWarning, "        %s", f)
+			}
+		default:
+			logger.Printf(logger.LvlInfo, "OK      %s", sum.Path)
+		}
+	}
+	logger.Printf(logger.LvlInfo, "Converted %d file(s): %d ok, %d with translation failures, %d failed",
+		len(summaries), len(summaries)-failed-partial, partial, failed)
+	return failed
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/circonus/grafana-ds-convert/grafana"
+	"github.com/circonus/grafana-ds-convert/internal/config"
+	"github.com/circonus/grafana-ds-convert/internal/config/keys"
+	"github.com/circonus/grafana-ds-convert/logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [run ID]",
+	Short: "Undo the writes of a conversion run",
+	Long: `rollback undoes the writes of a conversion run recorded in the journal
+file. Converted copies created by the run are deleted and dashboards that
+already existed, including those converted in place, are restored to the
+version they had before the run. Library panels and permissions are put back
+as they were, and the folders the run created are deleted once empty.
+
+Without a run ID the runs recorded in the journal are listed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString(keys.GrafanaJournalFile)
+		if path == "" {
+			log.Fatalf("journal_file must be set to roll back a run")
+		}
+		entries, err := grafana.ReadJournal(path)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(args) == 0 {
+			listRuns(entries)
+			return
+		}
+
+		var run []grafana.JournalEntry
+		for _, e := range entries {
+			if e.RunID == args[0] {
+				run = append(run, e)
+			}
+		}
+		if len(run) == 0 {
+			log.Fatalf("nothing recorded for run %q in %s", args[0], path)
+		}
+		if err := config.ValidateGrafana(); err != nil {
+			log.Fatalf("error validating config: %v", err)
+		}
+		gclient := grafana.New(grafanaURL(), viper.GetString(keys.GrafanaAPIToken), viper.GetBool(keys.Debug), viper.GetBool(keys.GrafanaNoAlerts), nil)
+		gclient.DryRun = viper.GetBool(keys.GrafanaDryRun)
+		deleted, rbErr := gclient.Rollback(context.Background(), run)
+
+		// deleted copies are no longer converted dashboards
+		if uidMapPath := viper.GetString(keys.GrafanaUIDMapFile); uidMapPath != "" && len(deleted) > 0 {
+			uidMap, err := grafana.LoadUIDMap(uidMapPath)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			for _, e := range run {
+				if !e.IsDashboard() {
+					continue
+				}
+				if dst, ok := uidMap.Lookup(e.SourceUID); ok && contains(deleted, dst) {
+					uidMap.Delete(e.SourceUID)
+				}
+			}
+			if err := uidMap.Save(); err != nil {
+				logger.Printf(logger.LvlError, "%v", err)
+			}
+		}
+		if rbErr != nil {
+			logger.Printf(logger.LvlError, "%v", rbErr)
+			os.Exit(1)
+		}
+		if gclient.DryRun {
+			logger.Printf(logger.LvlInfo, "Dry run complete, run %s was not rolled back", args[0])
+			return
+		}
+		logger.Printf(logger.LvlInfo, "Rolled back %d write(s) of run %s", len(run), args[0])
+	},
+}
+
+// listRuns prints the runs recorded in a journal with their dashboard counts
+// and the number of their other writes
+func listRuns(entries []grafana.JournalEntry) {
+	type runSummary struct {
+		id                      string
+		created, updated, other int
+	}
+	var runs []*runSummary
+	byID := make(map[string]*runSummary)
+	for _, e := range entries {
+		r, ok := byID[e.RunID]
+		if !ok {
+			r = &runSummary{id: e.RunID}
+			byID[e.RunID] = r
+			runs = append(runs, r)
+		}
+		switch {
+		case !e.IsDashboard():
+			r.other++
+		case e.PreviousVersion == 0:
+			r.created++
+		default:
+			r.updated++
+		}
+	}
+	for _, r := range runs {
+		fmt.Printf("%s\t%d created\t%d updated\t%d other write(s)\n", r.id, r.created, r.updated, r.other)
+	}
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
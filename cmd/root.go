@@ -1,14 +1,14 @@
 package cmd
 
 import (
+	"context"
 	_ "embed" //embedding the version file
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 
-	"github.com/bdunavant/sdk"
 	"github.com/circonus/grafana-ds-convert/circonus"
 	"github.com/circonus/grafana-ds-convert/grafana"
 	"github.com/circonus/grafana-ds-convert/internal/config"
@@ -23,7 +23,7 @@ import (
 //go:embed version.txt
 var version string
 var cfgFile string
-var localInputFile string
+var localInputFiles []string
 
 var rootCmd = &cobra.Command{
 	Use:   "grafana-ds-convert",
@@ -39,28 +39,29 @@ to Circonus Analytics Query Language (CAQL).`,
 		}
 
 		var queryStrings []string
-		var localDashboard *sdk.Board
-		if localInputFile != "" {
-			if strings.HasSuffix(localInputFile, ".json") {
-				// This is a dashboard .json
-				boardBytes, err := os.ReadFile(localInputFile)
-				if err != nil {
-					log.Fatalf("Unable to read from file %s: %v", localInputFile, err)
-					return
-				}
-				err = json.Unmarshal(boardBytes, &localDashboard)
-				if err != nil {
-					log.Fatalf("Unable to unmarshal dashboard from file %s: %v", localInputFile, err)
-				}
-				// log.Fatalf("%#v", localDashboard)
-			} else {
-				queryBytes, err := os.ReadFile(localInputFile)
-				if err != nil {
-					log.Fatalf("Unable to read from file %s: %v", localInputFile, err)
-					return
-				}
-				queryStrings = strings.Split(string(queryBytes), "\n")
+		var dashboardFiles []string
+		inputFiles, err := expandInputs(localInputFiles)
+		if err != nil {
+			log.Fatalf("Unable to find input files: %v", err)
+		}
+		var queryFiles []string
+		for _, inputFile := range inputFiles {
+			if strings.HasSuffix(inputFile, ".json") {
+				// This is a dashboard .json, these are read one at a time during conversion
+				dashboardFiles = append(dashboardFiles, inputFile)
+				continue
+			}
+			queryFiles = append(queryFiles, inputFile)
+			queryBytes, err := os.ReadFile(inputFile)
+			if err != nil {
+				log.Fatalf("Unable to read from file %s: %v", inputFile, err)
+				return
 			}
+			queryStrings = append(queryStrings, strings.Split(string(queryBytes), "\n")...)
+		}
+		// query files are translated on their own, without the dashboards
+		if len(queryFiles) > 0 && len(dashboardFiles) > 0 {
+			log.Fatalf("Unable to mix query files and dashboards, got query file %s and dashboard %s", queryFiles[0], dashboardFiles[0])
 		}
 
 		if viper.GetString(keys.ShowConfig) != "" {
@@ -76,18 +77,7 @@ to Circonus Analytics Query Language (CAQL).`,
 		}
 
 		// create circonus interface
-		circ, err := circonus.New(
-			viper.GetString(keys.CirconusHost),
-			viper.GetString(keys.CirconusPort),
-			viper.GetString(keys.CirconusAPIToken),
-			viper.GetInt(keys.CirconusAccountId),
-			viper.GetBool(keys.Debug),
-			viper.GetBool(keys.CirconusStatsdAggregationsRemove),
-			viper.GetBool(keys.CirconusDirectIRONdb),
-			viper.GetStringSlice(keys.CirconusStatsdAggregationsList),
-			viper.GetInt(keys.CirconusStatsdFlushInterval),
-			viper.GetInt(keys.CirconusStatsdPeriod),
-		)
+		circ, err := newCirconusClient()
 		if err != nil {
 			log.Fatalf("error connecting to circonus: %v", err)
 		}
@@ -108,36 +98,120 @@ to Circonus Analytics Query Language (CAQL).`,
 			return
 		}
 
-		// Create Grafana API URL
-		var url string
-		if viper.GetBool(keys.GrafanaTLS) {
-			if viper.GetString(keys.GrafanaPort) != "" {
-				url = fmt.Sprintf("https://%s:%s%s", viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPort), viper.GetString(keys.GrafanaPath))
-			} else {
-				url = fmt.Sprintf("https://%s%s", viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPath))
+		// create grafana API interface
+		gclient := grafana.New(grafanaURL(), viper.GetString(keys.GrafanaAPIToken), viper.GetBool(keys.Debug), viper.GetBool(keys.GrafanaNoAlerts), circ)
+		gclient.DryRun = viper.GetBool(keys.GrafanaDryRun)
+		gclient.Recursive = viper.GetBool(keys.GrafanaRecursive)
+		gclient.CreateDestFolder = viper.GetBool(keys.GrafanaCreateDestFolder)
+		gclient.CopyFolderPermissions = viper.GetBool(keys.GrafanaCopyFolderPermissions)
+		gclient.CopyPermissions = viper.GetBool(keys.GrafanaCopyPermissions)
+		gclient.InPlace = viper.GetBool(keys.GrafanaInPlace)
+		if msg := viper.GetString(keys.GrafanaCommitMessage); msg != "" {
+			gclient.CommitMessage = msg
+		}
+		if text := viper.GetString(keys.GrafanaTitleTemplate); text != "" {
+			if gclient.Stamp.Title, err = grafana.ParseTitleTemplate(text); err != nil {
+				log.Fatalf("error in title_template: %v", err)
 			}
-		} else {
-			if viper.GetString(keys.GrafanaPort) != "" {
-				url = fmt.Sprintf("http://%s:%s%s", viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPort), viper.GetString(keys.GrafanaPath))
-			} else {
-				url = fmt.Sprintf("http://%s%s", viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPath))
+		}
+		gclient.Stamp.AddTags = viper.GetStringSlice(keys.GrafanaAddTags)
+		gclient.Stamp.RemoveTags = viper.GetStringSlice(keys.GrafanaRemoveTags)
+		gclient.Stamp.Source = viper.GetBool(keys.GrafanaStampSource)
+		if limit := viper.GetInt(keys.GrafanaVariableResultsLimit); limit > 0 {
+			gclient.VariableResultsLimit = limit
+		}
+		gclient.MigratePanels = viper.GetBool(keys.GrafanaMigratePanels)
+		if n := viper.GetInt(keys.GrafanaFetchWorkers); n > 0 {
+			gclient.FetchWorkers = n
+		}
+		if n := viper.GetInt(keys.GrafanaTranslateWorkers); n > 0 {
+			gclient.TranslateWorkers = n
+		}
+		if n := viper.GetInt(keys.GrafanaWriteWorkers); n > 0 {
+			gclient.WriteWorkers = n
+		}
+		gclient.GraphiteDatasourceUIDs = viper.GetStringSlice(keys.GrafanaGraphiteDatasourceUIDs)
+		gclient.CirconusDatasourceUID = viper.GetString(keys.GrafanaCirconusDatasourceUID)
+		gclient.DefaultDatasource = viper.GetString(keys.GrafanaDefaultDatasource)
+		if gclient.Selector, err = newSelector(); err != nil {
+			log.Fatalf("error in dashboard selector: %v", err)
+		}
+		switch alerts := viper.GetString(keys.GrafanaAlerts); alerts {
+		case "":
+		case grafana.AlertsKeep, grafana.AlertsRemove:
+			gclient.Alerts = alerts
+		case grafana.AlertsRuleset:
+			gclient.Alerts = alerts
+			gclient.RulesetDir = viper.GetString(keys.GrafanaRulesetDir)
+			if gclient.RulesetDir == "" {
+				log.Fatalf("alerts = %q requires ruleset_dir", alerts)
 			}
+			if err := os.MkdirAll(gclient.RulesetDir, 0o755); err != nil {
+				log.Fatalf("error creating ruleset directory: %v", err)
+			}
+		default:
+			log.Fatalf("unknown alerts mode %q", alerts)
+		}
+		if path := viper.GetString(keys.GrafanaUIDMapFile); path != "" {
+			if gclient.UIDMap, err = grafana.LoadUIDMap(path); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+		prune := viper.GetBool(keys.GrafanaPrune)
+		if prune && viper.GetString(keys.GrafanaUIDMapFile) == "" {
+			log.Fatalf("prune requires uid_map_file to know which dashboards were converted")
+		}
+		switch onFailure := viper.GetString(keys.GrafanaOnFailure); onFailure {
+		case "":
+		case grafana.FailureKeep, grafana.FailureMixed, grafana.FailureAbort:
+			gclient.OnFailure = onFailure
+		default:
+			log.Fatalf("unknown on_failure policy %q", onFailure)
 		}
 
-		// create grafana API interface
-		gclient := grafana.New(url, viper.GetString(keys.GrafanaAPIToken), viper.GetBool(keys.Debug), viper.GetBool(keys.GrafanaNoAlerts), circ)
-
-		if localDashboard != nil {
-			// translate a single dashboard from file
-			boards := []sdk.Board{*localDashboard}
-			var emptyDstFolder sdk.FoundBoard
-			err = gclient.ConvertDashboards(boards, viper.GetString(keys.GrafanaCirconusDatasource), emptyDstFolder, viper.GetStringSlice(keys.GrafanaGraphiteDatasources))
-			if err != nil {
-				log.Fatalf("error translating local dashboard: %v", err)
+		// local files are written to stdout unless told otherwise
+		output := viper.GetString(keys.GrafanaOutput)
+		if output == "" {
+			if len(dashboardFiles) > 0 {
+				output = grafana.OutputStdout
+			} else {
+				output = grafana.OutputGrafana
 			}
+		}
+		if output == grafana.OutputGrafana && len(dashboardFiles) > 0 {
+			log.Fatalf("output %q is not supported when converting a local file", output)
+		}
+		// each file gets a converted file of its own rather than one stream
+		if output != grafana.OutputDir && len(dashboardFiles) > 1 && !gclient.DryRun {
+			log.Fatalf("converting %d dashboard files needs output %q, got %q", len(dashboardFiles), grafana.OutputDir, output)
+		}
+		if prune && (output != grafana.OutputGrafana || len(dashboardFiles) > 0) {
+			log.Fatalf("prune is only supported when converting from and to Grafana")
+		}
+		if prune && gclient.InPlace {
+			log.Fatalf("prune cannot be used with in_place, there are no copies to prune")
+		}
+		if gclient.InPlace && viper.GetString(keys.GrafanaDestFolder) != "" && len(dashboardFiles) == 0 {
+			logger.Printf(logger.LvlWarning, "Converting in place, dest_folder %q is ignored", viper.GetString(keys.GrafanaDestFolder))
+		}
+		if path := viper.GetString(keys.GrafanaJournalFile); path != "" && output == grafana.OutputGrafana && !gclient.DryRun {
+			gclient.Journal = grafana.NewJournal(path)
+		}
+		gclient.Sink, err = grafana.NewSink(output, viper.GetString(keys.GrafanaOutputDir), gclient)
+		if err != nil {
+			log.Fatalf("error setting up output: %v", err)
+		}
+
+		var results []*grafana.DashboardResult
+		failedFiles := 0
+		if len(dashboardFiles) > 0 {
+			// translate dashboards from local files
+			var summaries []fileSummary
+			results, summaries = convertFiles(gclient, dashboardFiles, viper.GetString(keys.GrafanaCirconusDatasource), viper.GetStringSlice(keys.GrafanaGraphiteDatasources))
+			failedFiles = printSummary(summaries)
 		} else {
 			// execute the translation
-			err = gclient.Translate(
+			results, err = gclient.Translate(
 				viper.GetString(keys.GrafanaSourceFolder),
 				viper.GetString(keys.GrafanaDestFolder),
 				viper.GetString(keys.GrafanaCirconusDatasource),
@@ -146,11 +220,92 @@ to Circonus Analytics Query Language (CAQL).`,
 			if err != nil {
 				log.Fatalf("error translating dashboards: %v", err)
 			}
+			if prune {
+				if _, err := gclient.Prune(context.Background()); err != nil {
+					logger.Printf(logger.LvlError, "error pruning dashboards: %v", err)
+				}
+			}
+			if !gclient.DryRun {
+				if err := gclient.UIDMap.Save(); err != nil {
+					logger.Printf(logger.LvlError, "%v", err)
+				}
+			}
+			if gclient.Journal != nil {
+				logger.Printf(logger.LvlInfo, "Run %s recorded in %s, undo it with: grafana-ds-convert rollback %s", gclient.Journal.RunID, viper.GetString(keys.GrafanaJournalFile), gclient.Journal.RunID)
+			}
+		}
+
+		if viper.GetBool(keys.GrafanaDryRun) {
+			logger.PrintMarshal(logger.LvlInfo, "Dry run plan:", results)
+		}
+		if path := viper.GetString(keys.GrafanaReportJSON); path != "" {
+			if err := grafana.WriteReportFile(path, results, grafana.WriteReportJSON); err != nil {
+				logger.Printf(logger.LvlError, "%v", err)
+			}
+		}
+		if path := viper.GetString(keys.GrafanaReportMarkdown); path != "" {
+			if err := grafana.WriteReportFile(path, results, grafana.WriteReportMarkdown); err != nil {
+				logger.Printf(logger.LvlError, "%v", err)
+			}
+		}
+		if failedFiles > 0 {
+			os.Exit(1)
 		}
 
 	},
 }
 
+// newCirconusClient creates the circonus interface from the configuration
+func newCirconusClient() (*circonus.Client, error) {
+	return circonus.New(
+		viper.GetString(keys.CirconusHost),
+		viper.GetString(keys.CirconusPort),
+		viper.GetString(keys.CirconusAPIToken),
+		viper.GetInt(keys.CirconusAccountId),
+		viper.GetBool(keys.Debug),
+		viper.GetBool(keys.CirconusStatsdAggregationsRemove),
+		viper.GetBool(keys.CirconusDirectIRONdb),
+		viper.GetStringSlice(keys.CirconusStatsdAggregationsList),
+		viper.GetInt(keys.CirconusStatsdFlushInterval),
+		viper.GetInt(keys.CirconusStatsdPeriod),
+	)
+}
+
+// newSelector builds the dashboard selector from the configuration
+func newSelector() (grafana.Selector, error) {
+	sel := grafana.Selector{
+		Tags:        viper.GetStringSlice(keys.GrafanaTags),
+		ExcludeTags: viper.GetStringSlice(keys.GrafanaExcludeTags),
+		UIDs:        viper.GetStringSlice(keys.GrafanaDashboardUIDs),
+		Query:       viper.GetString(keys.GrafanaSearchQuery),
+	}
+	if re := viper.GetString(keys.GrafanaTitleRegex); re != "" {
+		var err error
+		if sel.Title, err = regexp.Compile(re); err != nil {
+			return sel, fmt.Errorf("title_regex: %w", err)
+		}
+	}
+	if re := viper.GetString(keys.GrafanaExcludeTitleRegex); re != "" {
+		var err error
+		if sel.ExcludeTitle, err = regexp.Compile(re); err != nil {
+			return sel, fmt.Errorf("exclude_title_regex: %w", err)
+		}
+	}
+	return sel, nil
+}
+
+// grafanaURL builds the Grafana API URL from the configuration
+func grafanaURL() string {
+	scheme := "http"
+	if viper.GetBool(keys.GrafanaTLS) {
+		scheme = "https"
+	}
+	if viper.GetString(keys.GrafanaPort) != "" {
+		return fmt.Sprintf("%s://%s:%s%s", scheme, viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPort), viper.GetString(keys.GrafanaPath))
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, viper.GetString(keys.GrafanaHost), viper.GetString(keys.GrafanaPath))
+}
+
 // Execute kicks off the root cmd
 func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
@@ -158,14 +313,144 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	rootCmd.Flags().StringVarP(&cfgFile, "config", "c", "", "config file (default: $HOME/.grafana-ds-convert.yaml|.json|.toml)")
-	rootCmd.Flags().StringVarP(&localInputFile, "file", "f", "", "Take a local file to translate.")
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default: $HOME/.grafana-ds-convert.yaml|.json|.toml)")
+	rootCmd.Flags().StringSliceVarP(&localInputFiles, "file", "f", nil, "Take local files, directories or globs to translate (repeatable).")
 
 	rootCmd.PersistentFlags().String(keys.ShowConfig, "", "show config (json|toml|yaml) and exit")
 	if err := viper.BindPFlag(keys.ShowConfig, rootCmd.PersistentFlags().Lookup("show-config")); err != nil {
 		logger.Printf(logger.LvlError, "Error binding show-config %v", err)
 	}
 
+	rootCmd.PersistentFlags().Bool("dry-run", false, "fetch and translate dashboards but do not write them, print a conversion plan instead")
+	if err := viper.BindPFlag(keys.GrafanaDryRun, rootCmd.PersistentFlags().Lookup("dry-run")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding dry-run %v", err)
+	}
+
+	rootCmd.PersistentFlags().String("journal", "", "file recording the dashboards written to Grafana so that runs can be rolled back")
+	if err := viper.BindPFlag(keys.GrafanaJournalFile, rootCmd.PersistentFlags().Lookup("journal")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding journal %v", err)
+	}
+
+	rootCmd.Flags().StringP("output", "o", "", "where to write converted dashboards (grafana|stdout|dir)")
+	if err := viper.BindPFlag(keys.GrafanaOutput, rootCmd.Flags().Lookup("output")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding output %v", err)
+	}
+
+	rootCmd.Flags().String("output-dir", "", "directory to write converted dashboards to when output is dir")
+	if err := viper.BindPFlag(keys.GrafanaOutputDir, rootCmd.Flags().Lookup("output-dir")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding output-dir %v", err)
+	}
+
+	rootCmd.Flags().BoolP("recursive", "r", false, "convert the folders below the source folder too, recreating them below the destination folder")
+	if err := viper.BindPFlag(keys.GrafanaRecursive, rootCmd.Flags().Lookup("recursive")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding recursive %v", err)
+	}
+
+	rootCmd.Flags().Bool("create-dest-folder", false, "create the destination folder if it does not exist")
+	if err := viper.BindPFlag(keys.GrafanaCreateDestFolder, rootCmd.Flags().Lookup("create-dest-folder")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding create-dest-folder %v", err)
+	}
+
+	rootCmd.Flags().Bool("copy-folder-permissions", false, "copy the permissions of source folders onto the destination folders created for them")
+	if err := viper.BindPFlag(keys.GrafanaCopyFolderPermissions, rootCmd.Flags().Lookup("copy-folder-permissions")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding copy-folder-permissions %v", err)
+	}
+
+	rootCmd.Flags().Bool("copy-permissions", false, "give converted dashboards the permissions of their source dashboard")
+	if err := viper.BindPFlag(keys.GrafanaCopyPermissions, rootCmd.Flags().Lookup("copy-permissions")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding copy-permissions %v", err)
+	}
+
+	rootCmd.Flags().Bool("in-place", false, "update the source dashboards as a new version instead of creating converted copies")
+	if err := viper.BindPFlag(keys.GrafanaInPlace, rootCmd.Flags().Lookup("in-place")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding in-place %v", err)
+	}
+
+	rootCmd.Flags().StringP("message", "m", "", "version message of dashboards written to Grafana")
+	if err := viper.BindPFlag(keys.GrafanaCommitMessage, rootCmd.Flags().Lookup("message")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding message %v", err)
+	}
+
+	rootCmd.Flags().String("title-template", "", "template for the title of converted copies (default \"{{.Title}} Circonus\")")
+	if err := viper.BindPFlag(keys.GrafanaTitleTemplate, rootCmd.Flags().Lookup("title-template")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding title-template %v", err)
+	}
+
+	rootCmd.Flags().StringSlice("add-tag", nil, "add this tag to converted dashboards (repeatable)")
+	if err := viper.BindPFlag(keys.GrafanaAddTags, rootCmd.Flags().Lookup("add-tag")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding add-tag %v", err)
+	}
+
+	rootCmd.Flags().StringSlice("remove-tag", nil, "remove this tag from converted dashboards (repeatable)")
+	if err := viper.BindPFlag(keys.GrafanaRemoveTags, rootCmd.Flags().Lookup("remove-tag")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding remove-tag %v", err)
+	}
+
+	rootCmd.Flags().Bool("stamp-source", false, "note the source dashboard and conversion time in the description of converted dashboards and link copies to their source")
+	if err := viper.BindPFlag(keys.GrafanaStampSource, rootCmd.Flags().Lookup("stamp-source")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding stamp-source %v", err)
+	}
+
+	rootCmd.Flags().Int("variable-results-limit", 0, "number of values converted template variables fetch (default 500)")
+	if err := viper.BindPFlag(keys.GrafanaVariableResultsLimit, rootCmd.Flags().Lookup("variable-results-limit")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding variable-results-limit %v", err)
+	}
+
+	rootCmd.Flags().Bool("migrate-panels", false, "upgrade graph, singlestat and table-old panels of converted dashboards to timeseries, stat and table panels")
+	if err := viper.BindPFlag(keys.GrafanaMigratePanels, rootCmd.Flags().Lookup("migrate-panels")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding migrate-panels %v", err)
+	}
+
+	rootCmd.Flags().Int("fetch-workers", 0, "number of dashboards fetched from Grafana at once (default 4)")
+	if err := viper.BindPFlag(keys.GrafanaFetchWorkers, rootCmd.Flags().Lookup("fetch-workers")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding fetch-workers %v", err)
+	}
+
+	rootCmd.Flags().Int("translate-workers", 0, "number of dashboards converted, and of queries translated, at once (default 4)")
+	if err := viper.BindPFlag(keys.GrafanaTranslateWorkers, rootCmd.Flags().Lookup("translate-workers")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding translate-workers %v", err)
+	}
+
+	rootCmd.Flags().Int("write-workers", 0, "number of dashboards written at once (default 4)")
+	if err := viper.BindPFlag(keys.GrafanaWriteWorkers, rootCmd.Flags().Lookup("write-workers")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding write-workers %v", err)
+	}
+
+	rootCmd.Flags().StringSlice("tag", nil, "only convert dashboards having all of these tags (repeatable)")
+	if err := viper.BindPFlag(keys.GrafanaTags, rootCmd.Flags().Lookup("tag")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding tag %v", err)
+	}
+
+	rootCmd.Flags().StringSlice("exclude-tag", nil, "skip dashboards having any of these tags (repeatable)")
+	if err := viper.BindPFlag(keys.GrafanaExcludeTags, rootCmd.Flags().Lookup("exclude-tag")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding exclude-tag %v", err)
+	}
+
+	rootCmd.Flags().String("title-regex", "", "only convert dashboards whose title matches this regular expression")
+	if err := viper.BindPFlag(keys.GrafanaTitleRegex, rootCmd.Flags().Lookup("title-regex")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding title-regex %v", err)
+	}
+
+	rootCmd.Flags().String("exclude-title-regex", "", "skip dashboards whose title matches this regular expression")
+	if err := viper.BindPFlag(keys.GrafanaExcludeTitleRegex, rootCmd.Flags().Lookup("exclude-title-regex")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding exclude-title-regex %v", err)
+	}
+
+	rootCmd.Flags().StringSlice("uid", nil, "only convert the dashboards with these UIDs (repeatable)")
+	if err := viper.BindPFlag(keys.GrafanaDashboardUIDs, rootCmd.Flags().Lookup("uid")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding uid %v", err)
+	}
+
+	rootCmd.Flags().String("query", "", "only convert dashboards found by this Grafana search query")
+	if err := viper.BindPFlag(keys.GrafanaSearchQuery, rootCmd.Flags().Lookup("query")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding query %v", err)
+	}
+
+	rootCmd.Flags().Bool("prune", false, "delete converted dashboards whose source dashboard no longer exists (requires uid_map_file)")
+	if err := viper.BindPFlag(keys.GrafanaPrune, rootCmd.Flags().Lookup("prune")); err != nil {
+		logger.Printf(logger.LvlError, "Error binding prune %v", err)
+	}
+
 	rootCmd.Flags().BoolP("version", "v", false, "show version and exit")
 	if err := viper.BindPFlag(keys.ShowVersion, rootCmd.Flags().Lookup("version")); err != nil {
 		logger.Printf(logger.LvlError, "Error binding show-config %v", err)
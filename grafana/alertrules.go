@@ -0,0 +1,346 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/circonus/grafana-ds-convert/circonus"
+	"github.com/circonus/grafana-ds-convert/logger"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AlertRuleGroup is a Grafana unified alerting rule group as used by the
+// provisioning API. Interval is the evaluation interval in seconds.
+type AlertRuleGroup struct {
+	Title     string      `json:"title"`
+	FolderUID string      `json:"folderUid"`
+	Interval  int64       `json:"interval"`
+	Rules     []AlertRule `json:"rules"`
+}
+
+// AlertRule is a unified alerting rule. The folder and group fields are only
+// populated for rules fetched from the provisioning API.
+type AlertRule struct {
+	UID          string            `json:"uid,omitempty"`
+	OrgID        int64             `json:"orgID,omitempty"`
+	FolderUID    string            `json:"folderUID,omitempty"`
+	RuleGroup    string            `json:"ruleGroup,omitempty"`
+	Title        string            `json:"title"`
+	Condition    string            `json:"condition"`
+	Data         []AlertQuery      `json:"data"`
+	DashboardUID string            `json:"dashboardUid,omitempty"`
+	PanelID      int64             `json:"panelId,omitempty"`
+	NoDataState  string            `json:"noDataState,omitempty"`
+	ExecErrState string            `json:"execErrState,omitempty"`
+	For          string            `json:"for,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	IsPaused     bool              `json:"isPaused,omitempty"`
+}
+
+// AlertQuery is a single query or expression of an alert rule. The model is
+// datasource specific and kept as is apart from the fields we translate.
+type AlertQuery struct {
+	RefID             string                 `json:"refId"`
+	QueryType         string                 `json:"queryType,omitempty"`
+	RelativeTimeRange RelativeTimeRange      `json:"relativeTimeRange"`
+	DatasourceUID     string                 `json:"datasourceUid"`
+	Model             map[string]interface{} `json:"model"`
+}
+
+// RelativeTimeRange is the time range of an alert query in seconds before now
+type RelativeTimeRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// alertRuleFile is the layout of alert rules exported from Grafana
+type alertRuleFile struct {
+	APIVersion int               `json:"apiVersion"`
+	Groups     []exportRuleGroup `json:"groups"`
+}
+
+type exportRuleGroup struct {
+	OrgID    int64       `json:"orgId,omitempty"`
+	Name     string      `json:"name"`
+	Folder   string      `json:"folder"`
+	Interval string      `json:"interval"`
+	Rules    []AlertRule `json:"rules"`
+}
+
+// AlertRuleResult records the conversion of a single alert rule
+type AlertRuleResult struct {
+	UID      string          `json:"uid"`
+	Title    string          `json:"title"`
+	Group    string          `json:"group"`
+	Queries  []*TargetResult `json:"queries"`
+	Failures []string        `json:"failures,omitempty"`
+	Skipped  bool            `json:"skipped"`
+	// SkipReason tells why a rule without failures was left out
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// ReadAlertRuleFile reads alert rule groups exported from Grafana as YAML or
+// JSON. The folder of each group is returned in FolderUID as its title.
+func ReadAlertRuleFile(path string) ([]AlertRuleGroup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		// the yaml package decodes maps with interface keys, which cannot be
+		// handed to the json package
+		if data, err = json.Marshal(jsonValue(v)); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+	}
+	var f alertRuleFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	groups := make([]AlertRuleGroup, 0, len(f.Groups))
+	for _, eg := range f.Groups {
+		interval, err := intervalSeconds(eg.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("group %s in %s: interval %q: %w", eg.Name, path, eg.Interval, err)
+		}
+		groups = append(groups, AlertRuleGroup{Title: eg.Name, FolderUID: eg.Folder, Interval: interval, Rules: eg.Rules})
+	}
+	return groups, nil
+}
+
+// WriteAlertRuleFile writes alert rule groups in Grafana's export format, as
+// YAML if path ends in .yaml or .yml and as JSON otherwise
+func WriteAlertRuleFile(path string, groups []AlertRuleGroup) error {
+	f := alertRuleFile{APIVersion: 1}
+	for _, g := range groups {
+		f.Groups = append(f.Groups, exportRuleGroup{
+			OrgID:    1,
+			Name:     g.Title,
+			Folder:   g.FolderUID,
+			Interval: formatInterval(g.Interval),
+			Rules:    g.Rules,
+		})
+	}
+	data, err := json.MarshalIndent(f, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling alert rules: %w", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("error marshaling alert rules: %w", err)
+		}
+		if data, err = yaml.Marshal(v); err != nil {
+			return fmt.Errorf("error marshaling alert rules: %w", err)
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// AlertRuleGroups fetches the alert rule groups stored in a Grafana folder
+func (g Grafana) AlertRuleGroups(ctx context.Context, folderUID string) ([]AlertRuleGroup, error) {
+	var rules []AlertRule
+	if err := g.apiRequest(ctx, http.MethodGet, "api/v1/provisioning/alert-rules", nil, &rules); err != nil {
+		return nil, fmt.Errorf("error fetching alert rules: %w", err)
+	}
+	var groups []AlertRuleGroup
+	index := make(map[string]int)
+	for _, rule := range rules {
+		if rule.FolderUID != folderUID {
+			continue
+		}
+		i, ok := index[rule.RuleGroup]
+		if !ok {
+			var group AlertRuleGroup
+			apiPath := fmt.Sprintf("api/v1/provisioning/folder/%s/rule-groups/%s", url.PathEscape(folderUID), url.PathEscape(rule.RuleGroup))
+			if err := g.apiRequest(ctx, http.MethodGet, apiPath, nil, &group); err != nil {
+				return nil, fmt.Errorf("error fetching rule group %s: %w", rule.RuleGroup, err)
+			}
+			i = len(groups)
+			index[rule.RuleGroup] = i
+			groups = append(groups, AlertRuleGroup{Title: rule.RuleGroup, FolderUID: folderUID, Interval: group.Interval})
+		}
+		groups[i].Rules = append(groups[i].Rules, rule)
+	}
+	return groups, nil
+}
+
+// CreateAlertRuleGroups writes rule groups into a Grafana folder, replacing
+// any group of the same name in that folder
+func (g Grafana) CreateAlertRuleGroups(ctx context.Context, groups []AlertRuleGroup, folderUID string) error {
+	for _, group := range groups {
+		group.FolderUID = folderUID
+		if g.DryRun {
+			logger.Printf(logger.LvlInfo, "Dry run: skipping write of rule group %s with %d rule(s)", group.Title, len(group.Rules))
+			continue
+		}
+		apiPath := fmt.Sprintf("api/v1/provisioning/folder/%s/rule-groups/%s", url.PathEscape(folderUID), url.PathEscape(group.Title))
+		if err := g.apiRequest(ctx, http.MethodPut, apiPath, group, nil); err != nil {
+			return fmt.Errorf("error writing rule group %s: %w", group.Title, err)
+		}
+		logger.Printf(logger.LvlInfo, "Wrote rule group %s with %d rule(s)", group.Title, len(group.Rules))
+	}
+	return nil
+}
+
+// ConvertAlertRules translates the Graphite queries of alert rules into CAQL
+// queries against the Circonus datasource. Server side expressions and
+// queries against other datasources are left alone. Rules that cannot be
+// fully translated or have no Graphite query are left out of the returned
+// groups, as are groups that end up empty.
+func (g Grafana) ConvertAlertRules(groups []AlertRuleGroup, circonusUID string, graphiteUIDs []string) ([]AlertRuleGroup, []*AlertRuleResult, error) {
+	var out []AlertRuleGroup
+	var results []*AlertRuleResult
+	for _, group := range groups {
+		newGroup := AlertRuleGroup{Title: group.Title, FolderUID: group.FolderUID, Interval: group.Interval}
+		for _, rule := range group.Rules {
+			res := &AlertRuleResult{UID: rule.UID, Title: rule.Title, Group: group.Title}
+			results = append(results, res)
+			converted, failed := g.convertAlertRule(&rule, circonusUID, graphiteUIDs, res)
+			if failed {
+				res.Skipped = true
+				logger.Printf(logger.LvlWarning, "Skipping alert rule %s: %s", rule.Title, strings.Join(res.Failures, "; "))
+				if g.OnFailure == FailureAbort {
+					return nil, results, fmt.Errorf("alert rule %s: %w", rule.Title, ErrConversionAborted)
+				}
+				continue
+			}
+			if !converted {
+				// copying the rule would only duplicate it in the destination
+				res.Skipped = true
+				res.SkipReason = "no Graphite query"
+				logger.Printf(logger.LvlInfo, "Skipping alert rule %s: no Graphite query", rule.Title)
+				continue
+			}
+			// the copy gets new identifiers in its destination
+			rule.UID = ""
+			rule.FolderUID = ""
+			rule.RuleGroup = ""
+			newGroup.Rules = append(newGroup.Rules, rule)
+		}
+		if len(newGroup.Rules) > 0 {
+			out = append(out, newGroup)
+		}
+	}
+	return out, results, nil
+}
+
+// convertAlertRule translates the Graphite queries of a single rule in place
+// and reports whether any of them was translated and whether any failed
+func (g Grafana) convertAlertRule(rule *AlertRule, circonusUID string, graphiteUIDs []string, res *AlertRuleResult) (bool, bool) {
+	siblings := make(map[string]string)
+	for _, q := range rule.Data {
+		if contains(graphiteUIDs, q.DatasourceUID) {
+			siblings[q.RefID] = modelQuery(q.Model)
+		}
+	}
+	converted, failed := false, false
+	for i := range rule.Data {
+		q := &rule.Data[i]
+		if !contains(graphiteUIDs, q.DatasourceUID) {
+			continue
+		}
+		tres := &TargetResult{RefID: q.RefID, Original: siblings[q.RefID]}
+		res.Queries = append(res.Queries, tres)
+		expanded, err := expandTargetRefs(q.RefID, tres.Original, siblings)
+		if err == nil {
+			if expanded != tres.Original {
+				tres.Expanded = expanded
+			}
+			var tr *circonus.Translation
+			tr, err = g.CirconusClient.TranslateDetail(expanded)
+			if err == nil {
+				tres.CAQL = tr.CAQL
+				tres.StatsdRewrites = tr.StatsdRewrites
+			}
+		}
+		if err != nil {
+			tres.Error = err.Error()
+			res.Failures = append(res.Failures, fmt.Sprintf("query %s: %v", q.RefID, err))
+			failed = true
+			continue
+		}
+		converted = true
+		q.DatasourceUID = circonusUID
+		if q.Model == nil {
+			q.Model = make(map[string]interface{})
+		}
+		q.Model["querytype"] = "caql"
+		q.Model["query"] = tres.CAQL
+		delete(q.Model, "target")
+		delete(q.Model, "targetFull")
+		if _, ok := q.Model["datasource"]; ok {
+			q.Model["datasource"] = map[string]interface{}{"uid": circonusUID}
+		}
+	}
+	return converted, failed
+}
+
+// modelQuery returns the graphite query of an alert query model, preferring
+// the already expanded targetFull
+func modelQuery(model map[string]interface{}) string {
+	if s, ok := model["targetFull"].(string); ok && s != "" {
+		return s
+	}
+	s, _ := model["target"].(string)
+	return s
+}
+
+// intervalSeconds converts a rule group interval such as 1m into seconds
+func intervalSeconds(d string) (int64, error) {
+	if d == "" {
+		return 0, nil
+	}
+	m := durationRe.FindStringSubmatch(d)
+	if m == nil {
+		return 0, fmt.Errorf("unrecognised duration")
+	}
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+	unit := map[string]int64{"s": 1, "m": 60, "h": 3600, "d": 86400, "w": 604800}[m[2]]
+	return n * unit, nil
+}
+
+// formatInterval formats a rule group interval in seconds
+func formatInterval(secs int64) string {
+	if secs > 0 && secs%60 == 0 {
+		return strconv.FormatInt(secs/60, 10) + "m"
+	}
+	return strconv.FormatInt(secs, 10) + "s"
+}
+
+// jsonValue converts the maps decoded by the yaml package into maps with
+// string keys
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = jsonValue(val)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = jsonValue(t[i])
+		}
+	}
+	return v
+}
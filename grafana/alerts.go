@@ -0,0 +1,313 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// Modes for handling legacy Grafana panel alerts
+const (
+	// AlertsKeep keeps the Grafana alert, which now evaluates the converted CAQL query
+	AlertsKeep = "keep"
+	// AlertsRemove drops the alert from the panel
+	AlertsRemove = "remove"
+	// AlertsRuleset replaces the alert with Circonus ruleset definition files
+	AlertsRuleset = "ruleset"
+)
+
+// Ruleset is a Circonus ruleset definition built from a legacy Grafana alert.
+// The CAQL query is carried in metric_name, check must be set to the CID of
+// the CAQL check the ruleset belongs to before it is uploaded.
+type Ruleset struct {
+	Name       string        `json:"name"`
+	Check      string        `json:"check"`
+	MetricName string        `json:"metric_name"`
+	MetricType string        `json:"metric_type"`
+	Notes      string        `json:"notes,omitempty"`
+	Tags       []string      `json:"tags,omitempty"`
+	Rules      []RulesetRule `json:"rules"`
+}
+
+// RulesetRule is a single rule of a Circonus ruleset
+type RulesetRule struct {
+	Criteria string `json:"criteria"`
+	Severity int    `json:"severity"`
+	Value    string `json:"value"`
+	Wait     int    `json:"wait"`
+}
+
+// AlertResult records the conversion of a panel's legacy alert
+type AlertResult struct {
+	Name        string    `json:"name"`
+	Mode        string    `json:"mode"`
+	Rulesets    []Ruleset `json:"rulesets,omitempty"`
+	Files       []string  `json:"files,omitempty"`
+	Unsupported []string  `json:"unsupported,omitempty"`
+	// Kept is set when the Grafana alert stays on the panel alongside the
+	// rulesets, because some of its conditions have no ruleset
+	Kept bool `json:"kept,omitempty"`
+}
+
+// caqlWindows maps Grafana alert reducers to CAQL window functions, an empty
+// function means the raw value is used
+var caqlWindows = map[string]string{
+	"avg":  "window:mean",
+	"min":  "window:min",
+	"max":  "window:max",
+	"sum":  "window:sum",
+	"last": "",
+}
+
+// convertAlert handles the legacy alert of a converted panel according to the
+// configured alert mode, recording the outcome in pres
+func (g Grafana) convertAlert(panel *sdk.Panel, pres *PanelResult) {
+	if panel.Alert == nil {
+		return
+	}
+	mode := g.Alerts
+	ares := &AlertResult{Name: panel.Alert.Name, Mode: mode}
+	pres.Alert = ares
+	switch mode {
+	case AlertsRemove:
+		panel.Alert = nil
+	case AlertsRuleset:
+		var dropped int
+		ares.Rulesets, ares.Unsupported, dropped = alertRulesets(panel.Alert, pres)
+		// the Grafana alert only goes once rulesets take over every one of
+		// its conditions, otherwise it keeps alerting on all of them
+		switch {
+		case len(ares.Rulesets) == 0:
+		case dropped > 0:
+			ares.Kept = true
+			logger.Printf(logger.LvlWarning, "Panel %d: %s alert %q kept, %d of %d condition(s) have no ruleset", panel.ID, panel.Title, ares.Name, dropped, len(panel.Alert.Conditions))
+		default:
+			panel.Alert = nil
+		}
+	default:
+		// the alert keeps evaluating the same refIds, which only works if
+		// those targets were converted
+		ares.Mode = AlertsKeep
+		for _, cond := range panel.Alert.Conditions {
+			if len(cond.Query.Params) == 0 {
+				continue
+			}
+			if t := pres.target(cond.Query.Params[0]); t == nil || t.CAQL == "" {
+				ares.Unsupported = append(ares.Unsupported, fmt.Sprintf("condition on %s does not reference a converted CAQL query", cond.Query.Params[0]))
+			}
+		}
+	}
+	for _, u := range ares.Unsupported {
+		logger.Printf(logger.LvlWarning, "Panel %d: %s alert %q: %s", panel.ID, panel.Title, ares.Name, u)
+	}
+}
+
+// alertRulesets builds Circonus rulesets for the conditions of a legacy alert,
+// also returning the number of conditions left without a ruleset.
+// Conditions on the same query, reducer and window share a ruleset.
+func alertRulesets(alert *sdk.Alert, pres *PanelResult) ([]Ruleset, []string, int) {
+	var unsupported []string
+	if len(alert.Conditions) > 1 {
+		for _, cond := range alert.Conditions[1:] {
+			if cond.Operator.Type == "and" {
+				unsupported = append(unsupported, "conditions combined with AND are converted into independent rulesets")
+				break
+			}
+		}
+	}
+	if len(alert.Notifications) > 0 {
+		unsupported = append(unsupported, "notification channels must be mapped to Circonus contact groups by hand")
+	}
+	wait, err := alertMinutes(alert.For)
+	if err != nil {
+		unsupported = append(unsupported, fmt.Sprintf("cannot use pending period %q: %v", alert.For, err))
+	}
+
+	var rulesets []Ruleset
+	index := make(map[string]int)
+	// skip records a condition left without a ruleset
+	dropped := 0
+	skip := func(format string, v ...interface{}) {
+		unsupported = append(unsupported, fmt.Sprintf(format, v...))
+		dropped++
+	}
+	for _, cond := range alert.Conditions {
+		if cond.Type != "" && cond.Type != "query" {
+			skip("condition type %q", cond.Type)
+			continue
+		}
+		if len(cond.Query.Params) < 2 {
+			skip("condition without a query")
+			continue
+		}
+		refID, from := cond.Query.Params[0], cond.Query.Params[1]
+		if len(cond.Query.Params) > 2 && cond.Query.Params[2] != "now" {
+			skip("condition on %s ends at %s instead of now", refID, cond.Query.Params[2])
+			continue
+		}
+		t := pres.target(refID)
+		if t == nil || t.CAQL == "" {
+			skip("condition on %s does not reference a converted CAQL query", refID)
+			continue
+		}
+		window, ok := caqlWindows[cond.Reducer.Type]
+		if !ok {
+			skip("reducer %q on %s", cond.Reducer.Type, refID)
+			continue
+		}
+		duration, err := caqlDuration(from)
+		if err != nil {
+			skip("condition window %q on %s: %v", from, refID, err)
+			continue
+		}
+		rules, err := evaluatorRules(cond.Evaluator, duration, wait)
+		if err != nil {
+			skip("condition on %s: %v", refID, err)
+			continue
+		}
+		query := t.CAQL
+		if window != "" {
+			query = fmt.Sprintf("%s | %s(%s)", query, window, duration)
+		}
+		i, ok := index[query]
+		if !ok {
+			i = len(rulesets)
+			index[query] = i
+			rulesets = append(rulesets, Ruleset{
+				Name:       alert.Name,
+				MetricName: query,
+				MetricType: "caql",
+				Notes:      alert.Message,
+				Tags:       alertTags(alert.AlertRuleTags),
+			})
+			if alert.NoDataState == "alerting" {
+				rulesets[i].Rules = append(rulesets[i].Rules, RulesetRule{Criteria: "on absence", Severity: 1, Value: durationSeconds(duration), Wait: wait})
+			}
+		}
+		rulesets[i].Rules = append(rulesets[i].Rules, rules...)
+	}
+	if len(rulesets) > 1 {
+		for i := range rulesets {
+			rulesets[i].Name = fmt.Sprintf("%s (%d)", alert.Name, i+1)
+		}
+	}
+	return rulesets, unsupported, dropped
+}
+
+// evaluatorRules maps a Grafana alert evaluator onto ruleset rules
+func evaluatorRules(eval sdk.AlertEvaluator, duration string, wait int) ([]RulesetRule, error) {
+	param := func(i int) (string, error) {
+		if len(eval.Params) <= i {
+			return "", fmt.Errorf("evaluator %q is missing a threshold", eval.Type)
+		}
+		return strconv.FormatFloat(eval.Params[i], 'f', -1, 64), nil
+	}
+	switch eval.Type {
+	case "gt":
+		v, err := param(0)
+		if err != nil {
+			return nil, err
+		}
+		return []RulesetRule{{Criteria: "max value", Severity: 1, Value: v, Wait: wait}}, nil
+	case "lt":
+		v, err := param(0)
+		if err != nil {
+			return nil, err
+		}
+		return []RulesetRule{{Criteria: "min value", Severity: 1, Value: v, Wait: wait}}, nil
+	case "outside_range":
+		low, err := param(0)
+		if err != nil {
+			return nil, err
+		}
+		high, err := param(1)
+		if err != nil {
+			return nil, err
+		}
+		return []RulesetRule{
+			{Criteria: "max value", Severity: 1, Value: high, Wait: wait},
+			{Criteria: "min value", Severity: 1, Value: low, Wait: wait},
+		}, nil
+	case "no_value":
+		return []RulesetRule{{Criteria: "on absence", Severity: 1, Value: durationSeconds(duration), Wait: wait}}, nil
+	}
+	return nil, fmt.Errorf("evaluator %q cannot be expressed as a ruleset", eval.Type)
+}
+
+// durationRe matches the durations used by Grafana alerts, e.g. 5m or 1h
+var durationRe = regexp.MustCompile(`^(\d+)([smhdw])$`)
+
+// caqlDuration converts a Grafana duration into CAQL notation, where minutes
+// are written with an upper case M
+func caqlDuration(d string) (string, error) {
+	m := durationRe.FindStringSubmatch(d)
+	if m == nil {
+		return "", fmt.Errorf("unrecognised duration")
+	}
+	if m[2] == "m" {
+		return m[1] + "M", nil
+	}
+	return d, nil
+}
+
+// durationSeconds returns a CAQL duration in seconds
+func durationSeconds(d string) string {
+	n, _ := strconv.Atoi(d[:len(d)-1])
+	unit := map[byte]int{'s': 1, 'M': 60, 'h': 3600, 'd': 86400, 'w': 604800}[d[len(d)-1]]
+	return strconv.Itoa(n * unit)
+}
+
+// alertMinutes converts the pending period of an alert into whole minutes
+func alertMinutes(d string) (int, error) {
+	if d == "" || d == "0" {
+		return 0, nil
+	}
+	c, err := caqlDuration(d)
+	if err != nil {
+		return 0, err
+	}
+	secs, _ := strconv.Atoi(durationSeconds(c))
+	return int(math.Ceil(float64(secs) / 60)), nil
+}
+
+// alertTags converts alert rule tags into Circonus category:value tags
+func alertTags(tags map[string]string) []string {
+	var out []string
+	for k, v := range tags {
+		out = append(out, strings.ToLower(k)+":"+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeRulesets writes every ruleset of a dashboard to its own file in dir,
+// named after the dashboard and panel
+func writeRulesets(dir, name string, res *DashboardResult) error {
+	for _, p := range res.Panels {
+		if p.Alert == nil {
+			continue
+		}
+		for i, rs := range p.Alert.Rulesets {
+			data, err := json.MarshalIndent(rs, "", "    ")
+			if err != nil {
+				return fmt.Errorf("error marshaling ruleset: %w", err)
+			}
+			path := filepath.Join(dir, fmt.Sprintf("%s-panel%d-%d.json", name, p.ID, i+1))
+			if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+				return fmt.Errorf("error writing %s: %w", path, err)
+			}
+			p.Alert.Files = append(p.Alert.Files, path)
+			logger.Printf(logger.LvlInfo, "Wrote ruleset %s to %s", rs.Name, path)
+		}
+	}
+	return nil
+}
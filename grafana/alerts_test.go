@@ -0,0 +1,132 @@
+package grafana
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bdunavant/sdk"
+)
+
+// alertCondition builds a query condition of a legacy alert
+func alertCondition(refID, from, reducer, evaluator string, params ...float64) sdk.AlertCondition {
+	var cond sdk.AlertCondition
+	cond.Type = "query"
+	cond.Query.Params = []string{refID, from, "now"}
+	cond.Reducer.Type = reducer
+	cond.Evaluator.Type = evaluator
+	cond.Evaluator.Params = params
+	return cond
+}
+
+func TestAlertRulesets(t *testing.T) {
+	pres := &PanelResult{Targets: []*TargetResult{
+		{RefID: "A", CAQL: "find('a')"},
+		{RefID: "B", Error: "cannot translate"},
+	}}
+	tests := []struct {
+		name        string
+		alert       sdk.Alert
+		want        []Ruleset
+		wantDropped int
+	}{
+		{
+			name: "above threshold",
+			alert: sdk.Alert{Name: "cpu", For: "5m", Message: "cpu is high",
+				Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "avg", "gt", 90)}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a') | window:mean(5M)", MetricType: "caql", Notes: "cpu is high",
+				Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "90", Wait: 5}}}},
+		},
+		{
+			name:  "last value needs no window",
+			alert: sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("A", "1h", "last", "lt", 0.5)}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a')", MetricType: "caql",
+				Rules: []RulesetRule{{Criteria: "min value", Severity: 1, Value: "0.5"}}}},
+		},
+		{
+			name:  "outside range",
+			alert: sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("A", "10m", "max", "outside_range", 10, 80)}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a') | window:max(10M)", MetricType: "caql",
+				Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "80"}, {Criteria: "min value", Severity: 1, Value: "10"}}}},
+		},
+		{
+			name: "no data alerts on absence",
+			alert: sdk.Alert{Name: "cpu", NoDataState: "alerting",
+				Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "sum", "gt", 1)}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a') | window:sum(5M)", MetricType: "caql",
+				Rules: []RulesetRule{{Criteria: "on absence", Severity: 1, Value: "300"}, {Criteria: "max value", Severity: 1, Value: "1"}}}},
+		},
+		{
+			name: "tags",
+			alert: sdk.Alert{Name: "cpu", AlertRuleTags: map[string]string{"Team": "ops", "env": "prod"},
+				Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "last", "gt", 1)}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a')", MetricType: "caql", Tags: []string{"env:prod", "team:ops"},
+				Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "1"}}}},
+		},
+		{
+			name: "conditions on the same query share a ruleset",
+			alert: sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{
+				alertCondition("A", "5m", "avg", "gt", 90),
+				alertCondition("A", "5m", "avg", "lt", 5),
+			}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a') | window:mean(5M)", MetricType: "caql",
+				Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "90"}, {Criteria: "min value", Severity: 1, Value: "5"}}}},
+		},
+		{
+			name: "conditions on different windows get numbered rulesets",
+			alert: sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{
+				alertCondition("A", "5m", "avg", "gt", 90),
+				alertCondition("A", "1h", "avg", "gt", 70),
+			}},
+			want: []Ruleset{
+				{Name: "cpu (1)", MetricName: "find('a') | window:mean(5M)", MetricType: "caql",
+					Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "90"}}},
+				{Name: "cpu (2)", MetricName: "find('a') | window:mean(1h)", MetricType: "caql",
+					Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "70"}}},
+			},
+		},
+		{
+			name: "condition on a failed target",
+			alert: sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{
+				alertCondition("A", "5m", "avg", "gt", 90),
+				alertCondition("B", "5m", "avg", "gt", 90),
+			}},
+			want: []Ruleset{{Name: "cpu", MetricName: "find('a') | window:mean(5M)", MetricType: "caql",
+				Rules: []RulesetRule{{Criteria: "max value", Severity: 1, Value: "90"}}}},
+			wantDropped: 1,
+		},
+		{
+			name:        "condition on an unknown target",
+			alert:       sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("Z", "5m", "avg", "gt", 90)}},
+			wantDropped: 1,
+		},
+		{
+			name:        "unsupported reducer",
+			alert:       sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "diff", "gt", 90)}},
+			wantDropped: 1,
+		},
+		{
+			name:        "unsupported evaluator",
+			alert:       sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "avg", "within_range", 1, 2)}},
+			wantDropped: 1,
+		},
+		{
+			name:        "missing threshold",
+			alert:       sdk.Alert{Name: "cpu", Conditions: []sdk.AlertCondition{alertCondition("A", "5m", "avg", "gt")}},
+			wantDropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unsupported, dropped := alertRulesets(&tt.alert, pres)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alertRulesets() rulesets = %+v, want %+v", got, tt.want)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("alertRulesets() dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+			if len(unsupported) < dropped {
+				t.Errorf("alertRulesets() unsupported = %v, want a reason for each dropped condition", unsupported)
+			}
+		})
+	}
+}
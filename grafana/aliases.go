@@ -0,0 +1,367 @@
+package grafana
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// SeriesNameResult records an override or series color keyed on a series
+// name, rewritten for the names of the translated series or found to no
+// longer match them
+type SeriesNameResult struct {
+	Kind string `json:"kind"`
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+	// Unmatched tells why the override no longer matches
+	Unmatched string `json:"unmatched,omitempty"`
+}
+
+// graphiteFuncRe matches the name of a graphite function call
+var graphiteFuncRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// caqlLabelRe matches a CAQL query ending with a label() call
+var caqlLabelRe = regexp.MustCompile(`\|\s*label\(\s*(?:'([^']*)'|"([^"]*)")\s*\)\s*$`)
+
+// caqlFindRe matches a CAQL query fetching a single graphite path, with
+// the histogram function statsd aggregation rewrites add
+var caqlFindRe = regexp.MustCompile(`^\s*graphite:find(?::histogram)?\('([^']+)'\)(?:\s*\|\s*histogram:[a-z_]+\([^()]*\))?`)
+
+// parseCall splits a graphite function call into the function name and its
+// arguments, reporting false for anything else
+func parseCall(query string) (string, []string, bool) {
+	q := strings.TrimSpace(query)
+	open := strings.IndexByte(q, '(')
+	if open <= 0 || !strings.HasSuffix(q, ")") || !graphiteFuncRe.MatchString(q[:open]) {
+		return "", nil, false
+	}
+	var args []string
+	depth, start := 0, open+1
+	var quote rune
+	body := q[open+1 : len(q)-1]
+	for i, c := range body {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			if depth--; depth < 0 {
+				// the closing parenthesis is not that of the call
+				return "", nil, false
+			}
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(q[start:open+1+i]))
+			start = open + 2 + i
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return "", nil, false
+	}
+	if rest := strings.TrimSpace(q[start : len(q)-1]); rest != "" || len(args) > 0 {
+		args = append(args, rest)
+	}
+	return q[:open], args, true
+}
+
+// unquote returns a graphite string argument without its quotes
+func unquote(arg string) string {
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+// literalName reports whether a series name is known before the query runs,
+// rather than depending on the series a glob or a template variable finds
+func literalName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, globChars+"$")
+}
+
+// metricPath returns the metric path a graphite query fetches, the first
+// argument of nested function calls
+func metricPath(query string) string {
+	for {
+		_, args, ok := parseCall(query)
+		if !ok {
+			return strings.TrimSpace(query)
+		}
+		if len(args) == 0 {
+			return ""
+		}
+		query = args[0]
+	}
+}
+
+// seriesName returns the name graphite gives the series of a query, or ""
+// when it depends on the series found. Plain paths and other functions name
+// series after the query, the alias functions are resolved.
+func seriesName(query string) string {
+	fn, args, ok := parseCall(query)
+	if !ok {
+		if path := strings.TrimSpace(query); literalName(path) {
+			return path
+		}
+		return ""
+	}
+	var name string
+	switch fn {
+	case "alias":
+		if len(args) == 2 {
+			name = unquote(args[1])
+		}
+	case "aliasByNode", "aliasByMetric":
+		if len(args) == 0 {
+			return ""
+		}
+		nodes := strings.Split(metricPath(args[0]), ".")
+		if fn == "aliasByMetric" {
+			name = nodes[len(nodes)-1]
+			break
+		}
+		var parts []string
+		for _, a := range args[1:] {
+			n, err := strconv.Atoi(a)
+			if n < 0 {
+				n += len(nodes)
+			}
+			if err != nil || n < 0 || n >= len(nodes) {
+				return ""
+			}
+			parts = append(parts, nodes[n])
+		}
+		name = strings.Join(parts, ".")
+	case "aliasSub":
+		if len(args) != 3 {
+			return ""
+		}
+		inner := seriesName(args[0])
+		// graphite takes python regular expressions and \1 style groups
+		re, err := regexp.Compile(unquote(args[1]))
+		if inner == "" || err != nil {
+			return ""
+		}
+		replace := regexp.MustCompile(`\\(\d)`).ReplaceAllString(unquote(args[2]), "$${$1}")
+		name = re.ReplaceAllString(inner, replace)
+	default:
+		name = strings.TrimSpace(query)
+		if strings.Contains(name, "$") {
+			return ""
+		}
+		return name
+	}
+	if !literalName(name) {
+		return ""
+	}
+	return name
+}
+
+// caqlLabel returns the label the Circonus datasource gives the series of a
+// CAQL query, or "" when it depends on the series found. Series are labeled
+// with their metric name unless the query sets a label.
+func caqlLabel(caql string) string {
+	path := ""
+	if m := caqlFindRe.FindStringSubmatch(caql); m != nil && literalName(m[1]) {
+		path = m[1]
+	}
+	if m := caqlLabelRe.FindStringSubmatch(caql); m != nil {
+		label := m[1] + m[2]
+		if path != "" {
+			label = strings.ReplaceAll(label, "%n", path)
+		}
+		if strings.Contains(label, "%") || !literalName(label) {
+			return ""
+		}
+		return label
+	}
+	if m := caqlFindRe.FindString(caql); path != "" && strings.TrimSpace(m) == strings.TrimSpace(caql) {
+		return path
+	}
+	return ""
+}
+
+// seriesNames maps the series names of the graphite targets of a panel to
+// the labels of their translations
+type seriesNames struct {
+	// renamed maps graphite names to different CAQL labels
+	renamed map[string]string
+	// unknown holds the graphite names whose CAQL label is not known
+	unknown map[string]bool
+	// series and labels are the names of each translated target
+	series, labels []string
+}
+
+// newSeriesNames collects the series names of the targets of a panel model
+// that were replaced by their translation
+func newSeriesNames(panel map[string]interface{}, pres *PanelResult) *seriesNames {
+	s := &seriesNames{renamed: make(map[string]string), unknown: make(map[string]bool)}
+	targets, _ := panel["targets"].([]interface{})
+	for _, t := range targets {
+		target, _ := t.(map[string]interface{})
+		tres := pres.target(str(target["refId"]))
+		if tres == nil || tres.CAQL == "" || tres.Series == "" || str(target["query"]) != tres.CAQL {
+			continue
+		}
+		s.series = append(s.series, tres.Series)
+		s.labels = append(s.labels, tres.Label)
+		prev, seen := s.renamed[tres.Series]
+		switch {
+		case tres.Label == "" || (seen && prev != tres.Label):
+			s.unknown[tres.Series] = true
+			delete(s.renamed, tres.Series)
+		case tres.Label != tres.Series && !s.unknown[tres.Series]:
+			s.renamed[tres.Series] = tres.Label
+		}
+	}
+	return s
+}
+
+// rename returns the key an override keyed on a series name or a /regex/
+// takes after translation, or nil when it needs no change
+func (s *seriesNames) rename(kind, key string, regex bool) *SeriesNameResult {
+	if !regex {
+		if to, ok := s.renamed[key]; ok {
+			return &SeriesNameResult{Kind: kind, From: key, To: to}
+		}
+		if s.unknown[key] {
+			return &SeriesNameResult{Kind: kind, From: key, Unmatched: "the name of the translated series is not known"}
+		}
+		return nil
+	}
+	re, err := compileSeriesRegex(key)
+	if err != nil {
+		return nil
+	}
+	var matched, now []string
+	unknown := false
+	for i, series := range s.series {
+		if !re.MatchString(series) {
+			continue
+		}
+		label := s.labels[i]
+		if label != "" && re.MatchString(label) {
+			return nil
+		}
+		matched = append(matched, series)
+		if label == "" {
+			unknown = true
+		} else {
+			now = append(now, label)
+		}
+	}
+	switch {
+	case len(matched) == 0:
+		return nil
+	case unknown:
+		return &SeriesNameResult{Kind: kind, From: key, Unmatched: fmt.Sprintf("matched %s, the names of the translated series are not known", strings.Join(matched, ", "))}
+	}
+	return &SeriesNameResult{Kind: kind, From: key, Unmatched: fmt.Sprintf("matched %s, now named %s", strings.Join(matched, ", "), strings.Join(now, ", "))}
+}
+
+// compileSeriesRegex compiles a series regex as Grafana takes them, either
+// as a /regex/flags string or as a bare pattern matching whole names
+func compileSeriesRegex(s string) (*regexp.Regexp, error) {
+	if end := strings.LastIndex(s, "/"); strings.HasPrefix(s, "/") && end > 0 {
+		pattern := s[1:end]
+		if strings.Contains(s[end+1:], "i") {
+			pattern = "(?i)" + pattern
+		}
+		return regexp.Compile(pattern)
+	}
+	return regexp.Compile("^(?:" + s + ")$")
+}
+
+// isSeriesRegex reports whether a graph series override alias is a regex
+func isSeriesRegex(alias string) bool {
+	return len(alias) > 1 && strings.HasPrefix(alias, "/") && strings.LastIndex(alias, "/") > 0
+}
+
+// renameSeries rewrites the series overrides, series colors and field
+// overrides of converted panels keyed on series names, so that they keep
+// applying to the translated series. Regexes are left as they are, those no
+// longer matching are recorded.
+func (d *Dashboard) renameSeries(results []*PanelResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	byID := make(map[uint]*PanelResult, len(results))
+	for _, p := range results {
+		byID[p.ID] = p
+	}
+	return d.editModel(func(model map[string]interface{}) error {
+		forEachPanel(model, func(panel map[string]interface{}) {
+			id, _ := num(panel["id"])
+			if pres, ok := byID[uint(id)]; ok {
+				renamePanelSeries(panel, pres)
+			}
+		})
+		return nil
+	})
+}
+
+// renamePanelSeries rewrites the overrides of a panel model keyed on series
+// names
+func renamePanelSeries(panel map[string]interface{}, pres *PanelResult) {
+	s := newSeriesNames(panel, pres)
+	if len(s.series) == 0 {
+		return
+	}
+	record := func(r *SeriesNameResult) bool {
+		if r == nil {
+			return false
+		}
+		pres.SeriesNames = append(pres.SeriesNames, r)
+		if r.Unmatched != "" {
+			logger.Printf(logger.LvlWarning, "Panel %d: %s %s %s no longer matches, %s", pres.ID, pres.Title, r.Kind, r.From, r.Unmatched)
+			return false
+		}
+		return true
+	}
+
+	overrides, _ := panel["seriesOverrides"].([]interface{})
+	for _, o := range overrides {
+		so, _ := o.(map[string]interface{})
+		alias := str(so["alias"])
+		if r := s.rename("series override", alias, isSeriesRegex(alias)); record(r) {
+			so["alias"] = r.To
+		}
+	}
+	if colors, ok := panel["aliasColors"].(map[string]interface{}); ok {
+		renamed := make(map[string]interface{}, len(colors))
+		for _, alias := range sortedKeys(colors) {
+			key := alias
+			if r := s.rename("series color", alias, false); record(r) {
+				key = r.To
+			}
+			renamed[key] = colors[alias]
+		}
+		panel["aliasColors"] = renamed
+	}
+	fieldOverrides, _ := obj(panel, "fieldConfig")["overrides"].([]interface{})
+	for _, o := range fieldOverrides {
+		override, _ := o.(map[string]interface{})
+		matcher := obj(override, "matcher")
+		switch str(matcher["id"]) {
+		case "byName":
+			if r := s.rename("field override", str(matcher["options"]), false); record(r) {
+				matcher["options"] = r.To
+			}
+		case "byRegexp":
+			record(s.rename("field override", str(matcher["options"]), true))
+		case "byNames":
+			names, _ := obj(matcher, "options")["names"].([]interface{})
+			for i, n := range names {
+				if r := s.rename("field override", str(n), false); record(r) {
+					names[i] = r.To
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package grafana
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeriesName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"a.b.c", "a.b.c"},
+		{"a.*.c", ""},
+		{"sumSeries(a.b.c)", "sumSeries(a.b.c)"},
+		{"alias(a.b.c, 'requests')", "requests"},
+		{`alias(a.*.c, "requests")`, "requests"},
+		{"alias(a.b.c)", ""},
+		{"aliasByNode(a.b.c, 1)", "b"},
+		{"aliasByNode(a.b.c, 0, 2)", "a.c"},
+		{"aliasByNode(a.b.c, -1)", "c"},
+		{"aliasByNode(a.b.c, -3, -2)", "a.b"},
+		{"aliasByNode(a.b.c, -4)", ""},
+		{"aliasByNode(a.b.c, 3)", ""},
+		{"aliasByNode(a.*.c, 1)", ""},
+		{"aliasByNode(scale(a.b.c, 10), -1)", "c"},
+		{"aliasByMetric(a.b.c)", "c"},
+		{`aliasSub(a.b.c, 'a\.(\w+)\.c', '\1')`, "b"},
+		{`aliasSub(a.b.c, '(\w+)\.(\w+)\.(\w+)', '\3-\1')`, "c-a"},
+		{`aliasSub(alias(a.b.c, 'host1.cpu'), 'host(\d)', 'server\1')`, "server1.cpu"},
+		{`aliasSub(a.*.c, '(\w+)', '\1')`, ""},
+		{"alias(a.b.c, '$host')", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := seriesName(tt.query); got != tt.want {
+				t.Errorf("seriesName(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaqlLabel(t *testing.T) {
+	tests := []struct {
+		caql string
+		want string
+	}{
+		{"graphite:find('a.b.c')", "a.b.c"},
+		{"graphite:find('a.b.c') | histogram:count()", "a.b.c"},
+		{"graphite:find('a.*.c')", ""},
+		{"graphite:find('a.b.c') | label('requests')", "requests"},
+		{`graphite:find('a.b.c') | label("%n total")`, "a.b.c total"},
+		{"graphite:find('a.b.c') | label('%tags')", ""},
+		{"graphite:find('a.b.c') | label('%n')", "a.b.c"},
+		{"graphite:find('a.*.c') | label('%n')", ""},
+		{"graphite:find('a.b.c') | op:sum()", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caql, func(t *testing.T) {
+			if got := caqlLabel(tt.caql); got != tt.want {
+				t.Errorf("caqlLabel(%q) = %q, want %q", tt.caql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenamePanelSeries(t *testing.T) {
+	panel, _ := decodeModel([]byte(`{
+		"id": 1,
+		"targets": [
+			{"refId": "A", "query": "graphite:find('a.b.c') | label('requests')"},
+			{"refId": "B", "query": "graphite:find('a.b.d') | op:sum()"}
+		],
+		"seriesOverrides": [
+			{"alias": "a.b.c", "color": "red"},
+			{"alias": "/a\\.b\\..*/", "lines": false},
+			{"alias": "other", "lines": false}
+		],
+		"aliasColors": {"a.b.c": "blue", "a.b.d": "green"},
+		"fieldConfig": {"overrides": [
+			{"matcher": {"id": "byName", "options": "a.b.c"}},
+			{"matcher": {"id": "byRegexp", "options": "a\\.b\\.c"}},
+			{"matcher": {"id": "byRegexp", "options": "/^req/"}}
+		]}
+	}`))
+	pres := &PanelResult{ID: 1, Targets: []*TargetResult{
+		{RefID: "A", CAQL: "graphite:find('a.b.c') | label('requests')", Series: "a.b.c", Label: "requests"},
+		{RefID: "B", CAQL: "graphite:find('a.b.d') | op:sum()", Series: "a.b.d"},
+	}}
+	renamePanelSeries(panel, pres)
+
+	want := []*SeriesNameResult{
+		{Kind: "series override", From: "a.b.c", To: "requests"},
+		{Kind: "series override", From: `/a\.b\..*/`, Unmatched: "matched a.b.c, a.b.d, the names of the translated series are not known"},
+		{Kind: "series color", From: "a.b.c", To: "requests"},
+		{Kind: "series color", From: "a.b.d", Unmatched: "the name of the translated series is not known"},
+		{Kind: "field override", From: "a.b.c", To: "requests"},
+		{Kind: "field override", From: `a\.b\.c`, Unmatched: "matched a.b.c, now named requests"},
+	}
+	if !reflect.DeepEqual(pres.SeriesNames, want) {
+		for _, r := range pres.SeriesNames {
+			t.Logf("got %+v", *r)
+		}
+		t.Fatalf("renamePanelSeries() recorded %d series names, want %d", len(pres.SeriesNames), len(want))
+	}
+
+	overrides := panel["seriesOverrides"].([]interface{})
+	for i, alias := range []string{"requests", `/a\.b\..*/`, "other"} {
+		if got := overrides[i].(map[string]interface{})["alias"]; got != alias {
+			t.Errorf("seriesOverrides[%d].alias = %v, want %s", i, got, alias)
+		}
+	}
+	colors := panel["aliasColors"].(map[string]interface{})
+	if !reflect.DeepEqual(colors, map[string]interface{}{"requests": "blue", "a.b.d": "green"}) {
+		t.Errorf("aliasColors = %v", colors)
+	}
+	fieldOverrides := obj(panel, "fieldConfig")["overrides"].([]interface{})
+	for i, options := range []string{"requests", `a\.b\.c`, "/^req/"} {
+		if got := obj(fieldOverrides[i].(map[string]interface{}), "matcher")["options"]; got != options {
+			t.Errorf("overrides[%d].matcher.options = %v, want %s", i, got, options)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package grafana
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// AnnotationResult records the conversion of a dashboard annotation
+type AnnotationResult struct {
+	Name        string `json:"name"`
+	Original    string `json:"original,omitempty"`
+	CAQL        string `json:"caql,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Unsupported string `json:"unsupported,omitempty"`
+}
+
+// graphiteNameRe matches datasource names that look like graphite ones
+var graphiteNameRe = regexp.MustCompile(`(?i)graphite`)
+
+// convertAnnotations translates the graphite target of each graphite annotation
+// into a CAQL query against the Circonus datasource. Annotations built from
+// graphite events are reported as unsupported and left alone.
+func (g Grafana) convertAnnotations(board *Dashboard, ds *datasourceSet, res *DashboardResult) error {
+	for i := range board.Annotations.List {
+		a := &board.Annotations.List[i]
+		target, hasTarget := board.annotationTargets[i]
+		if a.Type == "dashboard" {
+			continue
+		}
+		if !ds.isGraphite(a.Datasource) {
+			if ds.unknownDefault(a.Datasource) {
+				res.addSkipped("annotation %s %s", a.Name, unknownDefaultReason)
+				logger.Printf(logger.LvlWarning, "Annotation %s %s", a.Name, unknownDefaultReason)
+			}
+			continue
+		}
+
+		ares := &AnnotationResult{Name: a.Name, Original: target}
+		res.Annotations = append(res.Annotations, ares)
+		if !hasTarget {
+			if len(a.Tags) > 0 {
+				ares.Unsupported = "graphite events matched by tags have no Circonus equivalent"
+			} else {
+				ares.Unsupported = "annotation has no graphite target"
+			}
+			logger.Printf(logger.LvlWarning, "Annotation %s: %s", a.Name, ares.Unsupported)
+			continue
+		}
+		tr, err := g.translate(target)
+		if err != nil {
+			ares.Error = err.Error()
+			res.addFailure("annotation %s: %v", a.Name, err)
+			logger.Printf(logger.LvlWarning, "Annotation %s: %v", a.Name, err)
+			if g.OnFailure == FailureAbort {
+				return fmt.Errorf("annotation %s: %w", a.Name, ErrConversionAborted)
+			}
+			continue
+		}
+		ares.CAQL = tr.CAQL
+		a.Datasource = ds.circonusRef(a.Datasource)
+		a.Query = tr.CAQL
+		delete(board.annotationTargets, i)
+		res.AnnotationsChanged++
+	}
+	return nil
+}
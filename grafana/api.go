@@ -0,0 +1,91 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// apiRequest issues a request against the Grafana HTTP API for endpoints the
+// sdk does not cover. body, if not nil, is sent as JSON and the response is
+// decoded into out when out is not nil.
+func (g Grafana) apiRequest(ctx context.Context, method, apiPath string, body, out interface{}) error {
+	u, err := url.Parse(g.baseURL)
+	if err != nil {
+		return fmt.Errorf("error parsing Grafana URL: %w", err)
+	}
+	query := ""
+	if i := strings.Index(apiPath, "?"); i >= 0 {
+		apiPath, query = apiPath[:i], apiPath[i+1:]
+	}
+	u.Path = path.Join(u.Path, apiPath)
+	u.RawQuery = query
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling request body: %w", err)
+		}
+		if g.Debug {
+			logger.PrintJSONBytes(logger.LvlDebug, method+" "+apiPath+" Request Body:", b)
+		}
+		reqBody = bytes.NewBuffer(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	// mirror the sdk's handling of API keys and basic auth credentials
+	if strings.Contains(g.apiKey, ":") {
+		parts := strings.SplitN(g.apiKey, ":", 2)
+		req.SetBasicAuth(parts[0], parts[1])
+	} else if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	// keep provisioned resources editable in the Grafana UI
+	req.Header.Set("X-Disable-Provenance", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s %s: %w", method, apiPath, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{StatusCode: resp.StatusCode, Method: method, Path: apiPath, Body: string(respBody)}
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error unmarshaling %s %s response: %w", method, apiPath, err)
+	}
+	return nil
+}
+
+// APIError is returned for Grafana API calls that do not succeed
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: HTTP error %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
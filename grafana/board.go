@@ -0,0 +1,378 @@
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+)
+
+// Dashboard is a dashboard being converted. The sdk drops the parts of the
+// dashboard model it has no fields for, those are kept alongside and written
+// back when the dashboard is marshaled. It also fills in the keys the model
+// left out with zero values, those are left out again unless changed.
+type Dashboard struct {
+	sdk.Board
+	// Description is the dashboard description
+	Description string
+	// File is the local file the dashboard was read from, if any
+	File string
+	// annotationTargets holds the graphite target of annotations by their
+	// index in the annotation list
+	annotationTargets map[int]string
+	// extra holds the parts of the JSON model the sdk dropped
+	extra partialObject
+	// added holds the parts the sdk filled in
+	added partialObject
+}
+
+// partialObject holds the keys of a JSON object the sdk dropped, along with
+// the dropped parts of the keys it kept
+type partialObject map[string]interface{}
+
+// partialArray holds the dropped parts of the elements of a JSON array kept
+// by the sdk, nil where nothing was dropped
+type partialArray []interface{}
+
+// DecodeBoard decodes a dashboard JSON model
+func DecodeBoard(raw []byte) (Dashboard, error) {
+	var d Dashboard
+	err := json.Unmarshal(raw, &d)
+	return d, err
+}
+
+// UnmarshalJSON decodes the dashboard and the fields the sdk does not keep
+func (d *Dashboard) UnmarshalJSON(raw []byte) error {
+	model, err := decodeModel(raw)
+	if err != nil {
+		return err
+	}
+	// the sdk only takes datasource references by name
+	encodeDatasourceRefs(model)
+	if raw, err = json.Marshal(model); err != nil {
+		return err
+	}
+	d.Board = sdk.Board{}
+	if err := json.Unmarshal(raw, &d.Board); err != nil {
+		return err
+	}
+	kept, err := sdkModel(d.Board)
+	if err != nil {
+		return err
+	}
+	d.extra, _ = droppedParts(model, kept).(partialObject)
+	d.added, _ = droppedParts(kept, model).(partialObject)
+
+	// the description and annotation targets are edited, so they are kept
+	// in fields of their own rather than restored as they were
+	d.Description, _ = model["description"].(string)
+	delete(d.extra, "description")
+	d.annotationTargets = nil
+	annotations, _ := model["annotations"].(map[string]interface{})
+	list, _ := annotations["list"].([]interface{})
+	extraAnnotations, _ := d.extra["annotations"].(partialObject)
+	extraList, _ := extraAnnotations["list"].(partialArray)
+	for i, a := range list {
+		annotation, _ := a.(map[string]interface{})
+		target, _ := annotation["target"].(string)
+		if target == "" {
+			continue
+		}
+		if d.annotationTargets == nil {
+			d.annotationTargets = make(map[int]string)
+		}
+		d.annotationTargets[i] = target
+		if i < len(extraList) {
+			if e, ok := extraList[i].(partialObject); ok {
+				delete(e, "target")
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the dashboard including the fields the sdk does not keep
+func (d Dashboard) MarshalJSON() ([]byte, error) {
+	model, err := sdkModel(d.Board)
+	if err != nil {
+		return nil, err
+	}
+	if d.Description != "" {
+		model["description"] = d.Description
+	}
+	annotations, _ := model["annotations"].(map[string]interface{})
+	list, _ := annotations["list"].([]interface{})
+	for i, target := range d.annotationTargets {
+		if i >= len(list) {
+			return nil, fmt.Errorf("annotation %d out of range", i)
+		}
+		if a, ok := list[i].(map[string]interface{}); ok {
+			a["target"] = target
+		}
+	}
+	if d.added != nil {
+		stripParts(model, d.added)
+	}
+	if d.extra != nil {
+		restoreParts(model, d.extra)
+	}
+	decodeDatasourceRefs(model)
+	return json.Marshal(model)
+}
+
+// editModel applies fn to the full JSON model of the dashboard, for changes
+// to parts the sdk does not know about, and decodes the result back into d
+func (d *Dashboard) editModel(fn func(model map[string]interface{}) error) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	model, err := decodeModel(raw)
+	if err != nil {
+		return err
+	}
+	if err := fn(model); err != nil {
+		return err
+	}
+	if raw, err = json.Marshal(model); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, d)
+}
+
+// inputs returns the inputs of a dashboard exported for sharing
+func (d Dashboard) inputs() []dashboardInput {
+	raw, err := json.Marshal(d.extra["__inputs"])
+	if err != nil {
+		return nil
+	}
+	var inputs []dashboardInput
+	if err := json.Unmarshal(raw, &inputs); err != nil {
+		return nil
+	}
+	return inputs
+}
+
+// decodeModel decodes a JSON object keeping numbers as they were written
+func decodeModel(raw []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var model map[string]interface{}
+	if err := dec.Decode(&model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// sdkModel returns the JSON model the sdk writes for a dashboard. Panels of
+// types the sdk does not know are written with their fields nested under a
+// CustomPanel key, they are moved back into the panel.
+func sdkModel(board sdk.Board) (map[string]interface{}, error) {
+	raw, err := json.Marshal(board)
+	if err != nil {
+		return nil, err
+	}
+	model, err := decodeModel(raw)
+	if err != nil {
+		return nil, err
+	}
+	forEachPanel(model, func(panel map[string]interface{}) {
+		custom, ok := panel["CustomPanel"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		delete(panel, "CustomPanel")
+		for k, v := range custom {
+			if _, ok := panel[k]; !ok {
+				panel[k] = v
+			}
+		}
+	})
+	return model, nil
+}
+
+// forEachPanel calls fn for every panel of a dashboard model, including the
+// panels of rows and of row panels
+func forEachPanel(model map[string]interface{}, fn func(panel map[string]interface{})) {
+	var walk func(panels interface{})
+	walk = func(panels interface{}) {
+		list, _ := panels.([]interface{})
+		for _, p := range list {
+			panel, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fn(panel)
+			walk(panel["panels"])
+		}
+	}
+	walk(model["panels"])
+	rows, _ := model["rows"].([]interface{})
+	for _, r := range rows {
+		if row, ok := r.(map[string]interface{}); ok {
+			walk(row["panels"])
+		}
+	}
+}
+
+// encodeDatasourceRefs replaces the datasource references given as objects
+// anywhere in a dashboard model by their JSON encoding
+func encodeDatasourceRefs(v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if obj, ok := child.(map[string]interface{}); ok && k == "datasource" {
+				if enc, err := json.Marshal(obj); err == nil {
+					val[k] = string(enc)
+				}
+				continue
+			}
+			encodeDatasourceRefs(child)
+		}
+	case []interface{}:
+		for _, child := range val {
+			encodeDatasourceRefs(child)
+		}
+	}
+}
+
+// decodeDatasourceRefs turns the references encoded by encodeDatasourceRefs
+// back into objects
+func decodeDatasourceRefs(v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if s, ok := child.(string); ok && k == "datasource" && strings.HasPrefix(s, "{") {
+				if obj, err := decodeModel([]byte(s)); err == nil {
+					val[k] = obj
+				}
+				continue
+			}
+			decodeDatasourceRefs(child)
+		}
+	case []interface{}:
+		for _, child := range val {
+			decodeDatasourceRefs(child)
+		}
+	}
+}
+
+// droppedParts returns the parts of raw missing from kept, or nil if nothing
+// is missing. Values kept with a different type or arrays kept with a
+// different length are owned by the sdk model and not looked into.
+func droppedParts(raw, kept interface{}) interface{} {
+	switch r := raw.(type) {
+	case map[string]interface{}:
+		k, ok := kept.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		missing := make(partialObject)
+		for key, rv := range r {
+			kv, ok := k[key]
+			if !ok {
+				missing[key] = rv
+				continue
+			}
+			if m := droppedParts(rv, kv); m != nil {
+				missing[key] = m
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		return missing
+	case []interface{}:
+		k, ok := kept.([]interface{})
+		if !ok || len(k) != len(r) {
+			return nil
+		}
+		missing := make(partialArray, len(r))
+		found := false
+		for i := range r {
+			if missing[i] = droppedParts(r[i], k[i]); missing[i] != nil {
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+		return missing
+	}
+	return nil
+}
+
+// restoreParts puts the parts returned by droppedParts back into model.
+// Dropped keys are restored where they are still missing, the dropped parts
+// of kept values only where the value is still there.
+func restoreParts(model interface{}, missing interface{}) {
+	switch m := missing.(type) {
+	case partialObject:
+		obj, ok := model.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, mv := range m {
+			v, ok := obj[key]
+			switch mv.(type) {
+			case partialObject, partialArray:
+				if ok {
+					restoreParts(v, mv)
+				}
+			default:
+				if !ok {
+					obj[key] = mv
+				}
+			}
+		}
+	case partialArray:
+		list, ok := model.([]interface{})
+		if !ok || len(list) != len(m) {
+			return
+		}
+		for i := range m {
+			if m[i] != nil {
+				restoreParts(list[i], m[i])
+			}
+		}
+	}
+}
+
+// stripParts removes the parts returned by droppedParts for the values the
+// sdk filled in from model, where they still hold the value filled in
+func stripParts(model interface{}, added interface{}) {
+	switch a := added.(type) {
+	case partialObject:
+		obj, ok := model.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, av := range a {
+			v, ok := obj[key]
+			if !ok {
+				continue
+			}
+			switch av.(type) {
+			case partialObject, partialArray:
+				stripParts(v, av)
+			default:
+				if reflect.DeepEqual(v, av) {
+					delete(obj, key)
+				}
+			}
+		}
+	case partialArray:
+		list, ok := model.([]interface{})
+		if !ok || len(list) != len(a) {
+			return
+		}
+		for i := range a {
+			if a[i] != nil {
+				stripParts(list[i], a[i])
+			}
+		}
+	}
+}
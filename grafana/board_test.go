@@ -0,0 +1,139 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sdkNormalized matches the values the sdk writes in another shape, the
+// text of the current value of variables as a list and a null all value as ""
+var sdkNormalized = regexp.MustCompile(`^\.templating\.list\[\d+\]\.(current\.text: \S+ != \[\S+\]|allValue: <nil> != )$`)
+
+// missingFrom returns the paths of the keys of want missing from got, and
+// the paths and values of the values they differ on
+func missingFrom(path string, want, got interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v != %v", path, want, got)}
+		}
+		var missing []string
+		for k, v := range w {
+			gv, ok := g[k]
+			if !ok {
+				missing = append(missing, path+"."+k)
+				continue
+			}
+			missing = append(missing, missingFrom(path+"."+k, v, gv)...)
+		}
+		return missing
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return []string{fmt.Sprintf("%s: %v != %v", path, want, got)}
+		}
+		var missing []string
+		for i := range w {
+			missing = append(missing, missingFrom(fmt.Sprintf("%s[%d]", path, i), w[i], g[i])...)
+		}
+		return missing
+	}
+	if !reflect.DeepEqual(want, got) {
+		return []string{fmt.Sprintf("%s: %v != %v", path, want, got)}
+	}
+	return nil
+}
+
+func TestDroppedParts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		kept string
+		want string
+	}{
+		{"nothing dropped", `{"a":1,"b":[{"c":2}]}`, `{"a":1,"b":[{"c":2}]}`, `null`},
+		{"dropped key", `{"a":1,"b":2}`, `{"a":1}`, `{"b":2}`},
+		{"dropped nested key", `{"a":{"b":1,"c":2}}`, `{"a":{"b":1}}`, `{"a":{"c":2}}`},
+		{"dropped in array element", `{"l":[{"a":1},{"a":2,"b":3}]}`, `{"l":[{"a":1},{"a":2}]}`, `{"l":[null,{"b":3}]}`},
+		{"array of another length", `{"l":[{"a":1,"b":2}]}`, `{"l":[]}`, `null`},
+		{"value of another type", `{"a":{"b":1}}`, `{"a":"x"}`, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, _ := decodeModel([]byte(tt.raw))
+			kept, _ := decodeModel([]byte(tt.kept))
+			got, err := json.Marshal(droppedParts(raw, kept))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var g, w interface{}
+			_ = json.Unmarshal(got, &g)
+			_ = json.Unmarshal([]byte(tt.want), &w)
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("droppedParts() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreParts(t *testing.T) {
+	raw, _ := decodeModel([]byte(`{"a":1,"b":{"c":2,"d":3},"l":[{"e":4,"f":5}]}`))
+	kept, _ := decodeModel([]byte(`{"a":1,"b":{"c":2},"l":[{"e":4}]}`))
+	restoreParts(kept, droppedParts(raw, kept))
+	if missing := missingFrom("", raw, kept); len(missing) > 0 {
+		t.Errorf("restoreParts() lost %v", missing)
+	}
+
+	// values changed since are not overwritten
+	edited, _ := decodeModel([]byte(`{"a":1,"b":{"c":2,"d":7},"l":[{"e":4}]}`))
+	restoreParts(edited, partialObject{"b": partialObject{"d": 3}})
+	if d := edited["b"].(map[string]interface{})["d"]; d != json.Number("7") {
+		t.Errorf("restoreParts() overwrote an edited value with %v", d)
+	}
+}
+
+func TestDashboardRoundTrip(t *testing.T) {
+	for _, name := range []string{"dashboard-with-rows.json", "dashboard-with-panels-that-have-rows.json"} {
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("..", "testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			board, err := DecodeBoard(raw)
+			if err != nil {
+				t.Fatalf("DecodeBoard() error = %v", err)
+			}
+			out, err := json.Marshal(board)
+			if err != nil {
+				t.Fatalf("MarshalJSON() error = %v", err)
+			}
+			want, _ := decodeModel(raw)
+			got, _ := decodeModel(out)
+			var missing, added []string
+			for _, m := range missingFrom("", want, got) {
+				if !sdkNormalized.MatchString(m) {
+					missing = append(missing, m)
+				}
+			}
+			if len(missing) > 0 {
+				t.Errorf("round trip lost or changed %d value(s): %v", len(missing), missing)
+			}
+			// the values changed are reported above
+			for _, a := range missingFrom("", got, want) {
+				if !strings.Contains(a, ": ") {
+					added = append(added, a)
+				}
+			}
+			if len(added) > 0 {
+				t.Errorf("round trip added %d value(s): %v", len(added), added)
+			}
+		})
+	}
+}
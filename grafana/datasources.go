@@ -0,0 +1,366 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// Datasource is a datasource configured in Grafana
+type Datasource struct {
+	ID        uint   `json:"id"`
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// Datasources lists the datasources configured in Grafana
+func (g Grafana) Datasources(ctx context.Context) ([]Datasource, error) {
+	var ds []Datasource
+	if err := g.apiRequest(ctx, http.MethodGet, "api/datasources", nil, &ds); err != nil {
+		return nil, fmt.Errorf("error fetching datasources: %w", err)
+	}
+	return ds, nil
+}
+
+// DatasourceUIDs resolves datasource names to their UIDs
+func (g Grafana) DatasourceUIDs(ctx context.Context, names []string) ([]string, error) {
+	ds, err := g.Datasources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]string, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, d := range ds {
+			if d.Name == name {
+				uids = append(uids, d.UID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no match found for datasource %q", name)
+		}
+	}
+	return uids, nil
+}
+
+// GraphiteUIDs returns the UIDs of the datasources of the graphite type,
+// narrowed to those with the given names when there are any
+func (g Grafana) GraphiteUIDs(ctx context.Context, names []string) ([]string, error) {
+	ds, err := g.Datasources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		found := false
+		for _, d := range ds {
+			found = found || d.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("no match found for datasource %q", name)
+		}
+	}
+	var uids []string
+	for _, d := range ds {
+		if d.Type == graphiteType && (len(names) == 0 || contains(names, d.Name)) {
+			uids = append(uids, d.UID)
+		}
+	}
+	return uids, nil
+}
+
+// Plugin types of the datasources the conversion deals with
+const (
+	graphiteType = "graphite"
+	circonusType = "circonus-datasource"
+)
+
+// circonusInput is the dashboard input converted exported dashboards use
+// for the Circonus datasource
+const circonusInput = "DS_CIRCONUS"
+
+// inputRe matches the ${DS_...} placeholders of dashboards exported for
+// sharing, bound to a datasource when the dashboard is imported
+var inputRe = regexp.MustCompile(`^\$\{?(DS_[A-Za-z0-9_]+)\}?$`)
+
+// datasourceRef is a datasource reference in a dashboard. Grafana stores
+// references as a name, as an object holding a type and a UID, or leaves
+// them out for the default datasource. Objects are carried through the sdk
+// model as JSON strings.
+type datasourceRef struct {
+	Type string `json:"type,omitempty"`
+	UID  string `json:"uid,omitempty"`
+	// Name is set for references by name
+	Name string `json:"-"`
+}
+
+// parseDatasourceRef parses a datasource reference as held in the sdk model,
+// reporting whether it is an object
+func parseDatasourceRef(ds *string) (datasourceRef, bool) {
+	if ds == nil || *ds == "" || *ds == "default" {
+		return datasourceRef{}, false
+	}
+	var ref datasourceRef
+	if strings.HasPrefix(*ds, "{") && json.Unmarshal([]byte(*ds), &ref) == nil {
+		return ref, true
+	}
+	return datasourceRef{Name: *ds}, false
+}
+
+// isDefault reports whether the reference is to the default datasource
+func (r datasourceRef) isDefault() bool {
+	return r == datasourceRef{}
+}
+
+// input returns the name of the dashboard input the reference is a
+// placeholder for, if any
+func (r datasourceRef) input() string {
+	for _, v := range []string{r.UID, r.Name} {
+		if m := inputRe.FindStringSubmatch(v); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// dashboardInput is an input of a dashboard exported for sharing
+type dashboardInput struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Type       string `json:"type"`
+	PluginID   string `json:"pluginId"`
+	PluginName string `json:"pluginName"`
+}
+
+// datasourceSet resolves the datasource references of dashboards
+type datasourceSet struct {
+	// graphiteNames are the configured graphite datasources, when empty
+	// every datasource of the graphite type is converted
+	graphiteNames []string
+	// graphiteUIDs are graphite datasources converted whatever their name
+	graphiteUIDs []string
+	// known are the datasources configured in Grafana, or those the
+	// configuration describes when they cannot be listed
+	known []Datasource
+	// defaultGraphite tells whether the default datasource is converted when
+	// it is not among the known datasources
+	defaultGraphite bool
+	// circonus is the datasource converted queries are pointed at
+	circonus Datasource
+	// inputs are the inputs of the dashboard being converted, by name
+	inputs map[string]dashboardInput
+	// usedInput is set once a reference to the Circonus input is handed out
+	usedInput bool
+}
+
+// offlineDatasources creates a datasource set from the configuration alone.
+// References to the default datasource are only converted when the default
+// datasource is configured and is one of the graphite datasources.
+func (g Grafana) offlineDatasources(circonusName string, graphiteNames []string) *datasourceSet {
+	s := &datasourceSet{
+		graphiteNames: graphiteNames,
+		graphiteUIDs:  g.GraphiteDatasourceUIDs,
+		circonus:      Datasource{Name: circonusName, UID: g.CirconusDatasourceUID, Type: circonusType},
+	}
+	for _, uid := range g.GraphiteDatasourceUIDs {
+		s.known = append(s.known, Datasource{UID: uid, Type: graphiteType, IsDefault: uid == g.DefaultDatasource})
+	}
+	if g.DefaultDatasource != "" && contains(graphiteNames, g.DefaultDatasource) {
+		s.defaultGraphite = true
+	}
+	return s
+}
+
+// loadDatasources creates a datasource set knowing the datasources configured
+// in Grafana. Listing datasources needs more privileges than converting
+// dashboards, without them the set is built from the configuration.
+func (g Grafana) loadDatasources(ctx context.Context, circonusName string, graphiteNames []string) *datasourceSet {
+	s := g.offlineDatasources(circonusName, graphiteNames)
+	known, err := g.Datasources(ctx)
+	if err != nil {
+		logger.Printf(logger.LvlWarning, "Matching datasources by configuration only: %v", err)
+		return s
+	}
+	s.known = known
+	s.defaultGraphite = false
+	for _, d := range known {
+		if d.Name == circonusName {
+			s.circonus = d
+		}
+	}
+	return s
+}
+
+// forBoard returns a copy of the set resolving the inputs of a dashboard
+func (s *datasourceSet) forBoard(inputs []dashboardInput) *datasourceSet {
+	b := *s
+	b.inputs = make(map[string]dashboardInput)
+	b.usedInput = false
+	for _, in := range inputs {
+		if in.Type == "datasource" {
+			b.inputs[in.Name] = in
+		}
+	}
+	return &b
+}
+
+// lookup finds the datasource a reference is to among the known ones
+func (s *datasourceSet) lookup(ref datasourceRef) (Datasource, bool) {
+	for _, d := range s.known {
+		switch {
+		case ref.isDefault() && d.IsDefault,
+			ref.UID != "" && d.UID == ref.UID,
+			ref.Name != "" && (d.Name == ref.Name || d.UID == ref.Name):
+			return d, true
+		}
+	}
+	return Datasource{}, false
+}
+
+// converted reports whether the queries of a known datasource are converted
+func (s *datasourceSet) converted(d Datasource) bool {
+	if contains(s.graphiteUIDs, d.UID) {
+		return true
+	}
+	if len(s.graphiteNames) > 0 {
+		return contains(s.graphiteNames, d.Name)
+	}
+	return d.Type == graphiteType
+}
+
+// isGraphite reports whether a datasource reference is to a graphite
+// datasource that is to be converted
+func (s *datasourceSet) isGraphite(ds *string) bool {
+	ref, _ := parseDatasourceRef(ds)
+	if name := ref.input(); name != "" {
+		in, ok := s.inputs[name]
+		if !ok {
+			return false
+		}
+		if len(s.graphiteNames) > 0 {
+			// the label is the name of the datasource the dashboard was
+			// exported from
+			return contains(s.graphiteNames, in.Label)
+		}
+		return in.PluginID == graphiteType
+	}
+	if d, ok := s.lookup(ref); ok {
+		return s.converted(d)
+	}
+	switch {
+	case ref.isDefault():
+		return s.defaultGraphite
+	case ref.Type != "":
+		return ref.Type == graphiteType && len(s.graphiteNames) == 0
+	case len(s.graphiteNames) > 0:
+		return contains(s.graphiteNames, ref.Name)
+	}
+	return graphiteNameRe.MatchString(ref.Name)
+}
+
+// unknownDefault reports whether a reference is to the default datasource
+// while which datasource that is is not known, as when converting offline
+// without a default datasource configured. Such references are left alone.
+func (s *datasourceSet) unknownDefault(ds *string) bool {
+	ref, _ := parseDatasourceRef(ds)
+	if !ref.isDefault() || s.defaultGraphite {
+		return false
+	}
+	_, ok := s.lookup(ref)
+	return !ok
+}
+
+// unknownDefaultReason tells why references to an unknown default
+// datasource are not converted
+const unknownDefaultReason = "uses the default datasource, which is not known to be Graphite; set default_datasource to convert it"
+
+// circonusRef returns a reference to the Circonus datasource in the form of
+// the reference it replaces: the Circonus input for an input, an object if
+// that was an object and the UID of the Circonus datasource is known, its
+// name otherwise
+func (s *datasourceSet) circonusRef(ds *string) *string {
+	ref := s.circonus.Name
+	orig, isObject := parseDatasourceRef(ds)
+	switch {
+	case orig.input() != "" && isObject:
+		s.usedInput = true
+		obj, _ := json.Marshal(datasourceRef{Type: s.circonus.Type, UID: "${" + circonusInput + "}"})
+		ref = string(obj)
+	case orig.input() != "":
+		s.usedInput = true
+		ref = "${" + circonusInput + "}"
+	case isObject && s.circonus.UID != "":
+		obj, _ := json.Marshal(datasourceRef{Type: s.circonus.Type, UID: s.circonus.UID})
+		ref = string(obj)
+	}
+	return &ref
+}
+
+// mixedRef returns a reference to the mixed datasource in the form of the
+// reference it replaces
+func mixedRef(ds *string) *string {
+	ref := sdk.MixedSource
+	if _, isObject := parseDatasourceRef(ds); isObject {
+		obj, _ := json.Marshal(datasourceRef{Type: "datasource", UID: sdk.MixedSource})
+		ref = string(obj)
+	}
+	return &ref
+}
+
+// addCirconusInput declares the Circonus input on a dashboard exported for
+// sharing and drops the inputs nothing refers to any more
+func (s *datasourceSet) addCirconusInput(board *Dashboard) error {
+	return board.editModel(func(model map[string]interface{}) error {
+		inputs, _ := model["__inputs"].([]interface{})
+		// the model without its inputs tells which ones are still in use
+		delete(model, "__inputs")
+		raw, err := json.Marshal(model)
+		if err != nil {
+			return err
+		}
+		var kept []interface{}
+		for _, i := range inputs {
+			in, _ := i.(map[string]interface{})
+			name, _ := in["name"].(string)
+			if name == circonusInput {
+				continue
+			}
+			used := regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(name) + `\b`)
+			if in["type"] != "datasource" || used.Match(raw) {
+				kept = append(kept, i)
+			}
+		}
+		kept = append(kept, map[string]interface{}{
+			"name":        circonusInput,
+			"label":       s.circonus.Name,
+			"description": "",
+			"type":        "datasource",
+			"pluginId":    s.circonus.Type,
+			"pluginName":  "Circonus",
+		})
+		model["__inputs"] = kept
+
+		requires, _ := model["__requires"].([]interface{})
+		for _, r := range requires {
+			if req, _ := r.(map[string]interface{}); req["id"] == s.circonus.Type {
+				return nil
+			}
+		}
+		model["__requires"] = append(requires, map[string]interface{}{
+			"type":    "datasource",
+			"id":      s.circonus.Type,
+			"name":    "Circonus",
+			"version": "",
+		})
+		return nil
+	})
+}
@@ -0,0 +1,197 @@
+package grafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// GeneralFolder is the name of Grafana's built in root folder, which has
+// neither an ID nor a UID and is not part of the folder API
+const GeneralFolder = "General"
+
+// ErrFolderNotFound is returned when a folder specification matches no folder
+var ErrFolderNotFound = errors.New("no match found for Grafana folder")
+
+// folderUIDPrefix marks a folder given by UID rather than by path
+const folderUIDPrefix = "uid:"
+
+// Folder is a Grafana dashboard folder. ParentUID is only set by Grafana
+// versions with nested folders.
+type Folder struct {
+	ID        uint   `json:"id"`
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	ParentUID string `json:"parentUid,omitempty"`
+	// Path is the slash separated path of titles from the top level
+	Path string `json:"-"`
+}
+
+// IsGeneral reports whether f is the General folder
+func (f Folder) IsGeneral() bool {
+	return f.UID == "" && f.Title == GeneralFolder
+}
+
+// FoundBoard returns the folder in the form the sdk search returns it
+func (f Folder) FoundBoard() sdk.FoundBoard {
+	return sdk.FoundBoard{ID: f.ID, UID: f.UID, Title: f.Path, Type: string(sdk.SearchTypeFolder)}
+}
+
+// folderOf returns the folder an sdk search result made by FoundBoard stands for
+func folderOf(fb sdk.FoundBoard) Folder {
+	return Folder{ID: fb.ID, UID: fb.UID, Title: fb.Title, Path: fb.Title}
+}
+
+// ResolveFolder finds a folder by its specification: "General", "uid:<uid>"
+// or a slash separated path of folder titles such as "Team/Infra/Prod". A
+// single title is a path of one element.
+func (g Grafana) ResolveFolder(ctx context.Context, spec string) (Folder, error) {
+	if spec == GeneralFolder {
+		return Folder{Title: GeneralFolder, Path: GeneralFolder}, nil
+	}
+	if strings.HasPrefix(spec, folderUIDPrefix) {
+		var f Folder
+		uid := strings.TrimPrefix(spec, folderUIDPrefix)
+		if err := g.apiRequest(ctx, http.MethodGet, "api/folders/"+url.PathEscape(uid), nil, &f); err != nil {
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				return Folder{}, fmt.Errorf("%w %q", ErrFolderNotFound, spec)
+			}
+			return Folder{}, fmt.Errorf("error fetching folder %s: %w", uid, err)
+		}
+		f.Path = f.Title
+		return f, nil
+	}
+	parent := Folder{Title: GeneralFolder, Path: GeneralFolder}
+	for _, title := range strings.Split(strings.Trim(spec, "/"), "/") {
+		children, err := g.SubFolders(ctx, parent)
+		if err != nil {
+			return Folder{}, err
+		}
+		var matches []Folder
+		for _, c := range children {
+			if c.Title == title {
+				matches = append(matches, c)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return Folder{}, fmt.Errorf("%w %q", ErrFolderNotFound, spec)
+		case 1:
+			parent = matches[0]
+		default:
+			return Folder{}, fmt.Errorf("folder %q is ambiguous, %d folders are titled %q, use %s<uid> instead", spec, len(matches), title, folderUIDPrefix)
+		}
+	}
+	return parent, nil
+}
+
+// SubFolders lists the folders directly inside parent. Grafana versions
+// without nested folders have only top level folders, which are the sub
+// folders of General.
+func (g Grafana) SubFolders(ctx context.Context, parent Folder) ([]Folder, error) {
+	apiPath := "api/folders?limit=1000"
+	if !parent.IsGeneral() {
+		apiPath += "&parentUid=" + url.QueryEscape(parent.UID)
+	}
+	var folders []Folder
+	if err := g.apiRequest(ctx, http.MethodGet, apiPath, nil, &folders); err != nil {
+		return nil, fmt.Errorf("error fetching grafana dashboard folders: %w", err)
+	}
+	// older versions ignore parentUid and list every folder
+	var children []Folder
+	for _, f := range folders {
+		if f.ParentUID != parent.UID {
+			continue
+		}
+		f.Path = f.Title
+		if !parent.IsGeneral() {
+			f.Path = parent.Path + "/" + f.Title
+		}
+		children = append(children, f)
+	}
+	return children, nil
+}
+
+// FolderTree returns root followed by every folder below it, depth first.
+// The subtree of skip, if set, is left out.
+func (g Grafana) FolderTree(ctx context.Context, root Folder, skip Folder) ([]Folder, error) {
+	tree := []Folder{root}
+	children, err := g.SubFolders(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		if skip.UID != "" && c.UID == skip.UID {
+			continue
+		}
+		sub, err := g.FolderTree(ctx, c, skip)
+		if err != nil {
+			return nil, err
+		}
+		tree = append(tree, sub...)
+	}
+	return tree, nil
+}
+
+// CreateFolderPath creates the folders of a folder path that do not exist
+// yet and returns the last one. Folders given by UID cannot be created.
+func (g Grafana) CreateFolderPath(ctx context.Context, spec string) (Folder, error) {
+	if strings.HasPrefix(spec, folderUIDPrefix) {
+		return Folder{}, fmt.Errorf("cannot create folder %q, give it by path instead", spec)
+	}
+	folder := Folder{Title: GeneralFolder, Path: GeneralFolder}
+	for _, title := range strings.Split(strings.Trim(spec, "/"), "/") {
+		var err error
+		if folder, _, err = g.EnsureFolder(ctx, folder, title); err != nil {
+			return Folder{}, err
+		}
+	}
+	return folder, nil
+}
+
+// EnsureFolder returns the folder titled title inside parent, creating it if
+// it does not exist, and whether it was created. In dry-run mode a missing
+// folder is not created and the returned folder has no UID.
+func (g Grafana) EnsureFolder(ctx context.Context, parent Folder, title string) (Folder, bool, error) {
+	path := title
+	if !parent.IsGeneral() {
+		path = parent.Path + "/" + title
+	}
+	// a parent that was not created in dry-run mode has no sub folders
+	if parent.UID != "" || parent.IsGeneral() {
+		children, err := g.SubFolders(ctx, parent)
+		if err != nil {
+			return Folder{}, false, err
+		}
+		for _, c := range children {
+			if c.Title == title {
+				return c, false, nil
+			}
+		}
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not creating folder %s", path)
+		return Folder{Title: title, Path: path}, true, nil
+	}
+	body := map[string]string{"title": title}
+	if !parent.IsGeneral() {
+		body["parentUid"] = parent.UID
+	}
+	var f Folder
+	if err := g.apiRequest(ctx, http.MethodPost, "api/folders", body, &f); err != nil {
+		return Folder{}, false, fmt.Errorf("error creating folder %s: %w", path, err)
+	}
+	f.Path = path
+	logger.Printf(logger.LvlInfo, "Created folder %s", path)
+	if err := g.record(JournalEntry{Kind: JournalFolder, DestUID: f.UID, Title: path}); err != nil {
+		return f, true, err
+	}
+	return f, true, nil
+}
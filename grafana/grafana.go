@@ -2,11 +2,11 @@ package grafana
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"text/template"
+	"time"
 
 	"github.com/bdunavant/sdk"
 	"github.com/circonus/grafana-ds-convert/circonus"
@@ -19,190 +19,647 @@ type Grafana struct {
 	CirconusClient *circonus.Client
 	Debug          bool
 	NoAlerts       bool
+	DryRun         bool
+	Sink           Sink
+	OnFailure      string
+	Alerts         string
+	RulesetDir     string
+	UIDMap         *UIDMap
+	Recursive      bool
+	Selector       Selector
+	// CreateDestFolder creates a missing destination folder
+	CreateDestFolder bool
+	// CopyFolderPermissions copies the permissions of source folders onto
+	// the destination folders created for them
+	CopyFolderPermissions bool
+	// CopyPermissions gives converted dashboards the permissions of their
+	// source dashboard
+	CopyPermissions bool
+	// InPlace writes converted dashboards back over their source as a new
+	// version instead of creating copies
+	InPlace bool
+	// CommitMessage is the version message of dashboards written to Grafana
+	CommitMessage string
+	// Journal, if set, records the dashboards written to Grafana
+	Journal *Journal
+	// Stamp names and marks converted dashboards
+	Stamp Stamp
+	// VariableResultsLimit is the number of values converted template
+	// variables fetch
+	VariableResultsLimit int
+	// GraphiteDatasourceUIDs and CirconusDatasourceUID identify datasources
+	// referred to by UID when the datasources of Grafana are not listed, as
+	// when converting local files
+	GraphiteDatasourceUIDs []string
+	CirconusDatasourceUID  string
+	// DefaultDatasource is the name or UID of the default datasource when the
+	// datasources of Grafana are not listed. References to the default
+	// datasource are only converted when it names a graphite datasource,
+	// when empty they are left alone and reported as skipped.
+	DefaultDatasource string
+	// MigratePanels upgrades the graph, singlestat and table-old panels of
+	// converted dashboards to the panels replacing them
+	MigratePanels bool
+	// FetchWorkers is the number of dashboards fetched at once
+	FetchWorkers int
+	// TranslateWorkers is the number of dashboards converted, and of
+	// queries translated, at once
+	TranslateWorkers int
+	// WriteWorkers is the number of dashboards written at once
+	WriteWorkers int
+
+	// links maps the dashboards of the run to their copies
+	links *linkMap
+	// datasources resolves the datasource references of the run
+	datasources *datasourceSet
+	// libraries holds the library panels converted during the run
+	libraries *libraryPanels
+	// translations holds a slot for every translation request in flight
+	translations chan struct{}
+
+	baseURL string
+	apiKey  string
 }
 
-// New creates a new Grafana
+// Policies for panels with targets that fail to translate
+const (
+	// FailureKeep leaves the whole panel, targets and datasource, untouched
+	FailureKeep = "keep"
+	// FailureMixed makes the panel mixed and keeps failed graphite targets hidden
+	FailureMixed = "mixed"
+	// FailureAbort skips writing the dashboard altogether
+	FailureAbort = "abort"
+)
+
+// DefaultCommitMessage is the version message used when none is configured
+const DefaultCommitMessage = "Convert Graphite queries to CAQL (grafana-ds-convert)"
+
+// ErrConversionAborted is returned when a dashboard conversion is abandoned
+// because of the abort failure policy
+var ErrConversionAborted = errors.New("dashboard conversion aborted")
+
+// New creates a new Grafana, converted dashboards are pushed to Grafana
+// unless another Sink is set
 func New(url, apikey string, debug, noAlerts bool, c *circonus.Client) Grafana {
-	return Grafana{
-		Client:         sdk.NewClient(url, apikey, http.DefaultClient, debug),
-		Debug:          debug,
-		CirconusClient: c,
-		NoAlerts:       noAlerts,
+	client := sdk.NewClient(url, apikey, http.DefaultClient, debug)
+	g := Grafana{
+		Client:               client,
+		Debug:                debug,
+		CirconusClient:       c,
+		NoAlerts:             noAlerts,
+		OnFailure:            FailureKeep,
+		Alerts:               AlertsKeep,
+		UIDMap:               NewUIDMap(),
+		CommitMessage:        DefaultCommitMessage,
+		Stamp:                Stamp{Title: template.Must(ParseTitleTemplate(DefaultTitleTemplate))},
+		VariableResultsLimit: DefaultVariableResultsLimit,
+		FetchWorkers:         DefaultWorkers,
+		TranslateWorkers:     DefaultWorkers,
+		WriteWorkers:         DefaultWorkers,
+		baseURL:              url,
+		apiKey:               apikey,
 	}
+	g.Sink = GrafanaSink{Grafana: g}
+	return g
 }
 
-// Translate is the main function which performs dashboard translations
-func (g Grafana) Translate(sourceFolder, destFolder, circonusDatasource string, graphiteDatasources []string) error {
-	// get grafana source and destination folders
-	var srcFolder sdk.FoundBoard
-	var dstFolder sdk.FoundBoard
-	foundFolders, err := g.Client.Search(context.Background(), sdk.SearchType(sdk.SearchTypeFolder))
-	if err != nil {
-		return fmt.Errorf("error fetching grafana dashboard folders: %w", err)
+// Translate is the main function which performs dashboard translations.
+// Folders are given as accepted by ResolveFolder. With Recursive set the
+// folders below the source folder are converted too, into a copy of the
+// folder hierarchy below the destination folder. The dashboards converted
+// are narrowed down by Selector; without a source folder the dashboards it
+// selects in any folder are converted. In InPlace mode the destination is
+// ignored and dashboards are updated in the folder they are in.
+func (g Grafana) Translate(sourceFolder, destFolder, circonusDatasource string, graphiteDatasources []string) ([]*DashboardResult, error) {
+	ctx := context.Background()
+	g.datasources = g.loadDatasources(ctx, circonusDatasource, graphiteDatasources)
+	g.libraries = newLibraryPanels()
+	if g.InPlace {
+		return g.translateInPlace(ctx, sourceFolder, circonusDatasource, graphiteDatasources)
 	}
-	for _, folder := range foundFolders {
-		if folder.Title == sourceFolder {
-			srcFolder = folder
-		} else if folder.Title == destFolder {
-			dstFolder = folder
+	if sourceFolder == "" && !g.Selector.IsSet() {
+		return nil, errors.New("a source folder or a dashboard selector is required")
+	}
+	// the source is resolved and checked before the destination is created,
+	// so that a mistyped source leaves no empty folders behind
+	var srcFolder Folder
+	if sourceFolder != "" {
+		var err error
+		if srcFolder, err = g.ResolveFolder(ctx, sourceFolder); err != nil {
+			return nil, fmt.Errorf("source folder: %w", err)
+		}
+	}
+	dstFolder, err := g.ResolveFolder(ctx, destFolder)
+	dstCreated := false
+	switch {
+	case errors.Is(err, ErrFolderNotFound) && g.CreateDestFolder:
+		if dstFolder, err = g.CreateFolderPath(ctx, destFolder); err != nil {
+			return nil, fmt.Errorf("destination folder: %w", err)
 		}
+		dstCreated = true
+	case err != nil:
+		return nil, fmt.Errorf("destination folder: %w", err)
+	case sourceFolder != "" && srcFolder.UID == dstFolder.UID && srcFolder.IsGeneral() == dstFolder.IsGeneral():
+		return nil, errors.New("source and destination folders must differ")
 	}
-	if srcFolder.Title == "" {
-		return errors.New("no match found for Grafana source folder")
+	if sourceFolder == "" {
+		boards, failed, err := g.folderBoards(ctx, nil, dstFolder)
+		if err != nil {
+			return nil, err
+		}
+		results, err := g.ConvertDashboards(boards, circonusDatasource, dstFolder.FoundBoard(), graphiteDatasources)
+		return append(results, failed...), err
 	}
-	if dstFolder.Title == "" {
-		return errors.New("no match found for Grafana destination folder")
+	if dstCreated && g.CopyFolderPermissions {
+		if err := g.copyFolderPermissions(ctx, srcFolder, dstFolder); err != nil {
+			return nil, err
+		}
 	}
 	// debug
 	if g.Debug {
 		logger.PrintMarshal(logger.LvlDebug, "Found source folder:", srcFolder)
-		logger.PrintMarshal(logger.LvlDebug, "Found destination folder:", destFolder)
+		logger.PrintMarshal(logger.LvlDebug, "Found destination folder:", dstFolder)
 	}
 
-	// get dashboards within found folder
-	foundBoards, err := g.Client.Search(context.Background(), sdk.SearchType(sdk.SearchTypeDashboard), sdk.SearchFolderID(int(srcFolder.ID)))
-	if err != nil {
-		return fmt.Errorf("error fetching dashboards within folder: %v", err)
+	srcFolders := []Folder{srcFolder}
+	if g.Recursive {
+		// never descend into the destination, it may live below the source
+		if srcFolders, err = g.FolderTree(ctx, srcFolder, dstFolder); err != nil {
+			return nil, err
+		}
 	}
-	// debug
-	if g.Debug {
-		logger.PrintMarshal(logger.LvlDebug, "Dashboards from Folder:", foundBoards)
+
+	// every dashboard is fetched first so that links between dashboards in
+	// different folders can be pointed at the copies
+	type batch struct {
+		dst    Folder
+		boards []Dashboard
+		failed []*DashboardResult
+	}
+	var batches []batch
+	g.links = g.newLinkMap()
+	dstFolders := map[string]Folder{srcFolder.UID: dstFolder}
+	for _, src := range srcFolders {
+		dst, ok := dstFolders[src.UID]
+		if !ok {
+			// parents come before their children in the tree
+			var created bool
+			if dst, created, err = g.EnsureFolder(ctx, dstFolders[src.ParentUID], src.Title); err != nil {
+				return nil, err
+			}
+			if created && g.CopyFolderPermissions {
+				if err := g.copyFolderPermissions(ctx, src, dst); err != nil {
+					return nil, err
+				}
+			}
+			dstFolders[src.UID] = dst
+		}
+		boards, failed, err := g.folderBoards(ctx, &src, dstFolder)
+		if err != nil {
+			return nil, err
+		}
+		if len(boards)+len(failed) == 0 {
+			continue
+		}
+		for _, b := range boards {
+			g.addCopy(g.links, b, dst.Path)
+		}
+		batches = append(batches, batch{dst: dst, boards: boards, failed: failed})
 	}
 
-	// loop through dashboards in the found folder and create an array of them as well as dashboard properties
-	var boards []sdk.Board
-	for _, b := range foundBoards {
-		brd, _, err := g.Client.GetDashboardByUID(context.Background(), b.UID)
+	var results []*DashboardResult
+	for _, b := range batches {
+		// start the dashboard conversion
+		folderResults, err := g.ConvertDashboards(b.boards, circonusDatasource, b.dst.FoundBoard(), graphiteDatasources)
+		results = append(results, folderResults...)
+		results = append(results, b.failed...)
 		if err != nil {
-			logger.Printf(logger.LvlError, "Dashboard %s skipped because it cannot be fetched or parsed. %v", b.UID, err)
+			return results, err
+		}
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run complete, no dashboards were written.")
+	} else {
+		logger.Printf(logger.LvlInfo, "Successfully converted dashboards, exiting.")
+	}
+	return results, nil
+}
+
+// translateInPlace converts the selected dashboards of the source folder, and
+// of its sub folders if Recursive is set, or of any folder without a source
+// folder, writing each one back to the folder it is in
+func (g Grafana) translateInPlace(ctx context.Context, sourceFolder, circonusDatasource string, graphiteDatasources []string) ([]*DashboardResult, error) {
+	var folders []Folder
+	found := make(map[string][]sdk.FoundBoard)
+	if sourceFolder == "" {
+		if !g.Selector.IsSet() {
+			return nil, errors.New("a source folder or a dashboard selector is required")
+		}
+		foundBoards, err := g.searchBoards(ctx, nil, Folder{})
+		if err != nil {
+			return nil, err
+		}
+		// group the dashboards by the folder they are in
+		for _, b := range foundBoards {
+			f := Folder{ID: uint(b.FolderID), UID: b.FolderUID, Title: b.FolderTitle, Path: b.FolderTitle}
+			if b.FolderID == 0 {
+				f = Folder{Title: GeneralFolder, Path: GeneralFolder}
+			}
+			if _, ok := found[f.UID]; !ok {
+				folders = append(folders, f)
+			}
+			found[f.UID] = append(found[f.UID], b)
+		}
+	} else {
+		srcFolder, err := g.ResolveFolder(ctx, sourceFolder)
+		if err != nil {
+			return nil, fmt.Errorf("source folder: %w", err)
+		}
+		folders = []Folder{srcFolder}
+		if g.Recursive {
+			if folders, err = g.FolderTree(ctx, srcFolder, Folder{}); err != nil {
+				return nil, err
+			}
+		}
+		for i := range folders {
+			if found[folders[i].UID], err = g.searchBoards(ctx, &folders[i], Folder{}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var results []*DashboardResult
+	for _, f := range folders {
+		if len(found[f.UID]) == 0 {
 			continue
 		}
-		boards = append(boards, brd)
+		boards, failed := g.fetchBoards(ctx, found[f.UID])
+		folderResults, err := g.ConvertDashboards(boards, circonusDatasource, f.FoundBoard(), graphiteDatasources)
+		results = append(results, folderResults...)
+		results = append(results, failed...)
+		if err != nil {
+			return results, err
+		}
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run complete, no dashboards were written.")
+	} else {
+		logger.Printf(logger.LvlInfo, "Successfully converted dashboards in place, exiting.")
 	}
+	return results, nil
+}
 
-	// start the dashboard conversion
-	err = g.ConvertDashboards(boards, circonusDatasource, dstFolder, graphiteDatasources)
+// folderBoards fetches the selected dashboards directly inside folder, or in
+// any folder but exclude if folder is nil, along with the results of those
+// that cannot be fetched
+func (g Grafana) folderBoards(ctx context.Context, folder *Folder, exclude Folder) ([]Dashboard, []*DashboardResult, error) {
+	foundBoards, err := g.searchBoards(ctx, folder, exclude)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	logger.Printf(logger.LvlInfo, "Successfully converted dashboards, exiting.")
-	return nil
+	boards, failed := g.fetchBoards(ctx, foundBoards)
+	return boards, failed, nil
+}
+
+// fetchBoards fetches the dashboards found by a search, FetchWorkers at a
+// time and in the order they were found. Those that cannot be fetched are
+// skipped and returned as failed results.
+func (g Grafana) fetchBoards(ctx context.Context, foundBoards []sdk.FoundBoard) ([]Dashboard, []*DashboardResult) {
+	// debug
+	if g.Debug {
+		logger.PrintMarshal(logger.LvlDebug, "Selected dashboards:", foundBoards)
+	}
+
+	fetched := make([]Dashboard, len(foundBoards))
+	errs := make([]error, len(foundBoards))
+	runWorkers(len(foundBoards), g.FetchWorkers, func(i int) {
+		raw, _, err := g.Client.GetRawDashboardByUID(ctx, foundBoards[i].UID)
+		if err == nil {
+			fetched[i], err = DecodeBoard(raw)
+		}
+		errs[i] = err
+	})
+	var boards []Dashboard
+	var failed []*DashboardResult
+	for i, b := range foundBoards {
+		if errs[i] != nil {
+			logger.Printf(logger.LvlError, "Dashboard %s skipped because it cannot be fetched or parsed. %v", b.UID, errs[i])
+			res := &DashboardResult{UID: b.UID, Title: b.Title}
+			res.addFailure("fetching dashboard: %v", errs[i])
+			failed = append(failed, res)
+			continue
+		}
+		boards = append(boards, fetched[i])
+	}
+	return boards, failed
 }
 
 // ConvertDashboards iterates through dashboards and converts
-// their panels to use CAQL as data queries
-func (g Grafana) ConvertDashboards(boards []sdk.Board, circonusDatasource string, destinationFolder sdk.FoundBoard, graphiteDatasources []string) error {
-	// loop through dashboards and their panels, translating "targetFull" or "target"
-	for _, board := range boards {
+// their panels to use CAQL as data queries. In dry-run mode every
+// translation is still performed but nothing is written.
+func (g Grafana) ConvertDashboards(boards []Dashboard, circonusDatasource string, destinationFolder sdk.FoundBoard, graphiteDatasources []string) ([]*DashboardResult, error) {
+	// Translate knows the dashboards of every folder of the run, otherwise
+	// links can point at the dashboards given here and those in the UID map
+	links := g.links
+	if links == nil {
+		links = g.newLinkMap()
+		for _, b := range boards {
+			g.addCopy(links, b, destinationFolder.Title)
+		}
+	}
+	// Translate lists the datasources of Grafana, local files only have
+	// the configuration to go by
+	dss := g.datasources
+	if dss == nil {
+		dss = g.offlineDatasources(circonusDatasource, graphiteDatasources)
+	}
+	// dashboards are converted, then written, several at a time. Results
+	// are kept by index so that they come out in the order of boards.
+	g = g.withTranslationSlots()
+	if g.libraries == nil {
+		g.libraries = newLibraryPanels()
+	}
+	results := make([]*DashboardResult, len(boards))
+	converted := make([]Dashboard, len(boards))
+	ok := make([]bool, len(boards))
+	runWorkers(len(boards), g.TranslateWorkers, func(i int) {
+		board := boards[i]
 		logger.Printf(logger.LvlInfo, "Converting Dashboard %d: %s", board.ID, board.Title)
-
-		if len(board.Templating.List) > 0 {
-			graphite_re := regexp.MustCompile(`(?i)graphite`)
-			for _, template := range board.Templating.List {
-				if template.Datasource != nil {
-					// Only convert graphite datasources
-					if !graphite_re.MatchString(*template.Datasource) {
-						if g.Debug {
-							logger.Printf(logger.LvlDebug, "Skipping template datasource %s since it doesn't match 'graphite'", *template.Datasource)
-						}
-						continue
-					}
-					if g.Debug {
-						logger.Printf(logger.LvlDebug, "Name: %s Type: %s Datasource %s\nQuery: %s", template.Name, template.Type, *template.Datasource, template.Query)
-					}
-					if template.Query != nil && len(*template.Query) > 0 {
-						*template.Datasource = circonusDatasource
-						// strip off the wrapping ""s
-						queryStr := *template.Query
-						queryStr = queryStr[1 : len(queryStr)-1]
-						// Marshal it back into escaped JSON so we can shove it as JSON safely into the RawMessage
-						escapedString, err := json.Marshal(string(queryStr))
-						if nil != err {
-							logger.Printf(logger.LvlError, "Cannot escape variable string: %s", *template.Query)
-							continue
-						}
-						newQueryObj := json.RawMessage(`{"metricFindQuery":` + string(escapedString) + `,"queryType":"graphite style","resultsLimit":500,"tagCategory":""}`)
-						if g.Debug {
-							logger.Printf(logger.LvlDebug, "variable query before: %s  object: %s", *template.Query, newQueryObj)
-						}
-						*template.Query = newQueryObj
-					}
-				}
+		results[i] = &DashboardResult{
+			UID:    board.UID,
+			Title:  board.Title,
+			Folder: destinationFolder.Title,
+		}
+		ok[i] = g.convertBoard(&board, dss, destinationFolder, results[i])
+		converted[i] = board
+	})
+	// dashboards written under the same name would overwrite each other,
+	// only the first of them is written
+	if g.namedOutput() {
+		names := make(map[string]string)
+		for i := range converted {
+			if !ok[i] {
+				continue
+			}
+			name := boardName(converted[i])
+			if first, taken := names[name]; taken {
+				logger.Printf(logger.LvlError, "Dashboard %s: %s is also the name of dashboard %s, not writing it", converted[i].Title, name, first)
+				results[i].addFailure("dashboard %s is already written as %s", first, name)
+				ok[i] = false
+				continue
 			}
+			names[name] = converted[i].Title
 		}
+	}
+	runWorkers(len(boards), g.writeWorkers(), func(i int) {
+		if ok[i] {
+			g.writeBoard(converted[i], links, destinationFolder, results[i])
+		}
+	})
+	return results, nil
+}
 
-		if len(board.Panels) >= 1 {
-			err := g.ConvertPanels(board.Panels, circonusDatasource, graphiteDatasources)
-			if err != nil {
-				logger.Printf(logger.LvlError, "Dashboard %d: %s %v", board.ID, board.Title, err)
-			}
-		} else {
-			if g.Debug {
-				logger.Printf(logger.LvlDebug, "No top level panels.")
+// convertBoard converts the variables, annotations and panels of a dashboard
+// on the graphite datasources of dss, reporting whether it is to be written
+func (g Grafana) convertBoard(board *Dashboard, dss *datasourceSet, destinationFolder sdk.FoundBoard, res *DashboardResult) bool {
+	ds := dss.forBoard(board.inputs())
+	g.convertVariables(board, ds, res)
+
+	if err := g.convertAnnotations(board, ds, res); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard %d: %s %v", board.ID, board.Title, err)
+		res.addFailure("%v", err)
+		return false
+	}
+
+	if len(board.Panels) >= 1 {
+		err := g.convertPanels(board.Panels, ds, res)
+		if err != nil {
+			logger.Printf(logger.LvlError, "Dashboard %d: %s %v", board.ID, board.Title, err)
+			if errors.Is(err, ErrConversionAborted) {
+				res.addFailure("%v", err)
+				return false
 			}
 		}
-		// Dashboards can also have "rows" and those rows can have their own panels, so look for those as well
-		if len(board.Rows) >= 1 {
-			foundOne := false
-			for _, row := range board.Rows {
-				if len(row.Panels) >= 1 {
-					foundOne = true
-					// board is []*Panel, vs Row is []Panel, so convert it into a slice of *'s so we can pass it in
-					var slicearoo []*sdk.Panel
-					for i := 0; i < len(row.Panels); i++ {
-						slicearoo = append(slicearoo, &row.Panels[i])
-					}
-					err := g.ConvertPanels(slicearoo, circonusDatasource, graphiteDatasources)
-					if err != nil {
-						logger.Printf(logger.LvlError, "Dashboard %d: %s error in row panel %v", board.ID, board.Title, err)
+	} else {
+		if g.Debug {
+			logger.Printf(logger.LvlDebug, "No top level panels.")
+		}
+	}
+	// Dashboards can also have "rows" and those rows can have their own panels, so look for those as well
+	if len(board.Rows) >= 1 {
+		foundOne := false
+		aborted := false
+		for _, row := range board.Rows {
+			if len(row.Panels) >= 1 {
+				foundOne = true
+				// board is []*Panel, vs Row is []Panel, so convert it into a slice of *'s so we can pass it in
+				var slicearoo []*sdk.Panel
+				for i := 0; i < len(row.Panels); i++ {
+					slicearoo = append(slicearoo, &row.Panels[i])
+				}
+				err := g.convertPanels(slicearoo, ds, res)
+				if err != nil {
+					logger.Printf(logger.LvlError, "Dashboard %d: %s error in row panel %v", board.ID, board.Title, err)
+					if errors.Is(err, ErrConversionAborted) {
+						res.addFailure("%v", err)
+						aborted = true
+						break
 					}
 				}
 			}
-			if g.Debug && !foundOne {
-				logger.Printf(logger.LvlDebug, "No panels in rows.")
-			}
-		} else {
-			if g.Debug {
-				logger.Printf(logger.LvlDebug, "No top level rows.")
-			}
 		}
-
-		// We are running in local mode so just print the output
-		if destinationFolder.Title == "" {
-			logger.PrintMarshal(logger.LvlInfo, "Converted Dashboard: ", board)
-			return nil
+		if aborted {
+			return false
+		}
+		if g.Debug && !foundOne {
+			logger.Printf(logger.LvlDebug, "No panels in rows.")
 		}
+	} else {
 		if g.Debug {
-			logger.PrintMarshal(logger.LvlDebug, "Converted Dashboard: ", board)
+			logger.Printf(logger.LvlDebug, "No top level rows.")
 		}
-		newBoard := board
+	}
+
+	if err := board.renameSeries(res.Panels); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+		res.addFailure("renaming series: %v", err)
+		return false
+	}
+
+	if err := g.convertLibraryPanels(board, dss, folderOf(destinationFolder), res); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard %d: %s %v", board.ID, board.Title, err)
+		res.addFailure("%v", err)
+		return false
+	}
+
+	if g.MigratePanels {
+		if err := g.migratePanels(board, res); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("migrating panels: %v", err)
+			return false
+		}
+	}
+
+	if ds.usedInput {
+		if err := ds.addCirconusInput(board); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("declaring the Circonus input: %v", err)
+			return false
+		}
+	}
+
+	if g.Debug {
+		logger.PrintMarshal(logger.LvlDebug, "Converted Dashboard: ", board)
+	}
+	return true
+}
+
+// writeBoard names, stamps and writes a converted dashboard, along with its
+// permissions, rulesets and journal entry
+func (g Grafana) writeBoard(board Dashboard, links *linkMap, destinationFolder sdk.FoundBoard, res *DashboardResult) {
+	newBoard := board
+	// when converting from a Grafana folder the result is a new copy
+	// of the dashboard, local files are converted as they are. Copies
+	// keep the same UID across runs so that re-running updates them.
+	// In place conversions keep the UID, title and version, so that
+	// Grafana saves them as a new version of the source.
+	copied := destinationFolder.Title != "" && !g.InPlace
+	if copied {
 		newBoard.ID = 0
 		newBoard.UID = ""
-		newBoard.Title += " Circonus"
-		setDashParams := sdk.SetDashboardParams{
-			FolderID:  int(destinationFolder.ID),
-			Overwrite: true,
+		if board.UID != "" {
+			newBoard.UID = g.UIDMap.DestUID(board.UID)
 		}
-		sm, err := g.Client.SetDashboard(context.Background(), newBoard, setDashParams)
+	}
+	if copied {
+		err := newBoard.editModel(func(model map[string]interface{}) error {
+			res.LinksRewritten = links.rewriteLinks(model)
+			return nil
+		})
 		if err != nil {
 			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("rewriting links: %v", err)
+			return
 		}
-		if g.Debug {
-			logger.PrintMarshal(logger.LvlDebug, "Create Dashboard Response:", sm)
+	}
+	if err := g.stampBoard(&newBoard, board, destinationFolder.Title, copied, time.Now()); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+		res.addFailure("%v", err)
+		return
+	}
+	res.NewTitle = newBoard.Title
+	res.NewUID = newBoard.UID
+	if g.InPlace {
+		res.PreviousVersion = board.Version
+		if res.PanelsChanged+res.VariablesChanged+res.AnnotationsChanged == 0 {
+			logger.Printf(logger.LvlInfo, "Nothing to convert in dashboard %s, not writing a new version", board.Title)
+			// the library panels it uses may still have been converted
+			if !g.DryRun {
+				if err := g.saveLibraryPanels(res); err != nil {
+					logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+					res.addFailure("%v", err)
+				}
+			}
+			return
 		}
 	}
-	return nil
+	var perms []Permission
+	_, toGrafana := g.Sink.(GrafanaSink)
+	copyPerms := g.CopyPermissions && !g.InPlace && toGrafana && board.UID != "" && newBoard.UID != ""
+	if copyPerms {
+		var err error
+		perms, res.Permissions, err = g.mapDashboardPermissions(context.Background(), board.UID, folderOf(destinationFolder))
+		if err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("reading permissions: %v", err)
+			copyPerms = false
+		} else {
+			for _, u := range res.Permissions.Unmapped {
+				logger.Printf(logger.LvlWarning, "Dashboard %s: cannot copy permission for %s", board.Title, u)
+			}
+			for _, e := range res.Permissions.Extra {
+				logger.Printf(logger.LvlWarning, "Dashboard %s: destination folder also grants %s", board.Title, e)
+			}
+		}
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not writing dashboard %s", newBoard.Title)
+		res.Written = true
+		return
+	}
+	// the dashboard may be linked to library panel copies that are only
+	// written along with it
+	if err := g.saveLibraryPanels(res); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+		res.addFailure("%v", err)
+		return
+	}
+	if g.Alerts == AlertsRuleset {
+		if err := writeRulesets(g.RulesetDir, boardName(board), res); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("writing rulesets: %v", err)
+		}
+	}
+	// the journal needs the version being replaced to roll back to it
+	journal := g.Journal != nil && toGrafana && newBoard.UID != ""
+	var prevVersion uint
+	if journal && g.InPlace {
+		prevVersion = board.Version
+	} else if journal {
+		var err error
+		if prevVersion, err = g.dashboardVersion(context.Background(), newBoard.UID); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("%v", err)
+			return
+		}
+	}
+	if err := g.Sink.Write(boardName(board), newBoard, destinationFolder); err != nil {
+		logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+		res.addFailure("writing dashboard: %v", err)
+		return
+	}
+	res.Written = true
+	if journal {
+		entry := JournalEntry{SourceUID: board.UID, DestUID: newBoard.UID, Title: newBoard.Title, PreviousVersion: prevVersion}
+		if err := g.Journal.Record(entry); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("%v", err)
+		}
+	}
+	if newBoard.UID != "" && board.UID != "" && newBoard.UID != board.UID {
+		g.UIDMap.Set(board.UID, newBoard.UID)
+	}
+	if copyPerms {
+		if err := g.SetDashboardPermissions(context.Background(), newBoard.UID, newBoard.Title, perms); err != nil {
+			logger.Printf(logger.LvlError, "Dashboard: %s : %v", board.Title, err)
+			res.addFailure("writing permissions: %v", err)
+		}
+	}
+}
+
+// ConvertPanels converts individual panels of a dashboard to use CAQL as data queries,
+// recording the changes made in res
+func (g Grafana) ConvertPanels(p []*sdk.Panel, circonusDatasource string, graphiteDatasources []string, res *DashboardResult) error {
+	dss := g.datasources
+	if dss == nil {
+		dss = g.offlineDatasources(circonusDatasource, graphiteDatasources)
+	}
+	return g.convertPanels(p, dss.forBoard(nil), res)
 }
 
-// ConvertPanels converts individual panels of a dashboard to use CAQL as data queries
-func (g Grafana) ConvertPanels(p []*sdk.Panel, circonusDatasource string, graphiteDatasources []string) error {
+// convertPanels converts the panels on the graphite datasources of ds
+func (g Grafana) convertPanels(p []*sdk.Panel, ds *datasourceSet, res *DashboardResult) error {
 	for _, panel := range p {
 		logger.Printf(logger.LvlInfo, "Converting Panel %d: %s", panel.ID, panel.Title)
-		if panel.Datasource != nil {
-			if len(graphiteDatasources) > 0 && !contains(graphiteDatasources, *panel.Datasource) {
-				logger.Printf(logger.LvlInfo, "Skipping panel due to datasource type.")
+		mixed := isMixed(panel.Datasource)
+		if panel.OfType != sdk.RowType && !mixed && !ds.isGraphite(panel.Datasource) {
+			if ds.unknownDefault(panel.Datasource) {
+				res.addSkipped("panel %d %s %s", panel.ID, panel.Title, unknownDefaultReason)
+				logger.Printf(logger.LvlWarning, "Panel %d: %s %s", panel.ID, panel.Title, unknownDefaultReason)
 				continue
 			}
+			logger.Printf(logger.LvlInfo, "Skipping panel due to datasource type.")
+			continue
 		}
 		if panel.OfType == sdk.RowType && len(panel.Panels) >= 1 {
 			// A row panel, can have it's own set of panel inside (who designed this?) loop through THOSE panels and process them
@@ -214,7 +671,10 @@ func (g Grafana) ConvertPanels(p []*sdk.Panel, circonusDatasource string, graphi
 			for i := 0; i < len(panel.Panels); i++ {
 				slicearoo = append(slicearoo, &panel.Panels[i])
 			}
-			err := g.ConvertPanels(slicearoo, circonusDatasource, graphiteDatasources)
+			err := g.convertPanels(slicearoo, ds, res)
+			if errors.Is(err, ErrConversionAborted) {
+				return err
+			}
 			if err != nil {
 				logger.Printf(logger.LvlError, "Error converting Subpanel inside panel %d : %v", panel.ID, err)
 				// skip it and keep going
@@ -228,47 +688,181 @@ func (g Grafana) ConvertPanels(p []*sdk.Panel, circonusDatasource string, graphi
 		if targets == nil {
 			continue
 		}
-		if panel.Datasource == nil {
-			strcpy := circonusDatasource
-			panel.Datasource = &strcpy
-		} else {
-			*panel.Datasource = circonusDatasource
-		}
 		if g.NoAlerts && panel.Alert != nil {
 			panel.Alert = nil
 		}
-		if len(*targets) >= 1 {
-			for _, target := range *targets {
-				target.QueryType = "caql"
-				if target.TargetFull != "" {
-					newTargetStr, err := g.CirconusClient.Translate(target.TargetFull)
-					if err != nil {
-						logger.Printf(logger.LvlError, "Panel: %s Target: %s %v", panel.Title, target.TargetFull, err)
-					}
-					target.Query = newTargetStr
-					target.Target = ""
-					target.TargetFull = ""
-					panel.SetTarget(&target)
+		if len(*targets) == 0 {
+			if g.Debug {
+				logger.Printf(logger.LvlInfo, "No targets")
+			}
+			if !mixed {
+				panel.Datasource = ds.circonusRef(panel.Datasource)
+			}
+			continue
+		}
+		// the targets of mixed panels each have their own datasource, only
+		// the graphite ones are converted
+		graphite := make([]bool, len(*targets))
+		found := false
+		for i, target := range *targets {
+			graphite[i] = !mixed || ds.isGraphite(&target.Datasource)
+			found = found || graphite[i]
+		}
+		if !found {
+			logger.Printf(logger.LvlInfo, "Skipping mixed panel without graphite targets.")
+			continue
+		}
+		// translate every target before touching the panel so that a failure
+		// can be handled without losing the working graphite queries
+		pres := res.addPanel(panel.ID, panel.Title)
+		siblings := make(map[string]string, len(*targets))
+		for i, target := range *targets {
+			if graphite[i] {
+				siblings[target.RefID] = graphiteQuery(target)
+			}
+		}
+		referenced := referencedTargets(siblings)
+		// tresults holds the result of each target, nil for the targets of
+		// other datasources
+		tresults := make([]*TargetResult, len(*targets))
+		queries := make([]string, len(*targets))
+		errs := make([]error, len(*targets))
+		for i, target := range *targets {
+			if !graphite[i] {
+				continue
+			}
+			original := graphiteQuery(target)
+			tres := &TargetResult{RefID: target.RefID, Original: original}
+			pres.Targets = append(pres.Targets, tres)
+			tresults[i] = tres
+			// the translator cannot resolve #A style references, so inline them
+			queries[i], errs[i] = expandTargetRefs(target.RefID, original, siblings)
+			if errs[i] == nil && queries[i] != original {
+				tres.Expanded = queries[i]
+			}
+		}
+		// the queries are translated concurrently, the outcomes are then
+		// handled in the order of the targets
+		translations := make([]*circonus.Translation, len(*targets))
+		runWorkers(len(*targets), g.TranslateWorkers, func(i int) {
+			if tresults[i] != nil && errs[i] == nil {
+				translations[i], errs[i] = g.translate(queries[i])
+			}
+		})
+		failed := 0
+		for i, target := range *targets {
+			tres := tresults[i]
+			if tres == nil {
+				continue
+			}
+			original := tres.Original
+			if err := errs[i]; err != nil {
+				logger.Printf(logger.LvlError, "Panel: %s Target: %s %v", panel.Title, original, err)
+				res.addFailure("panel %d %q target %s: %v", panel.ID, panel.Title, target.RefID, err)
+				tres.Error = err.Error()
+				if target.Hide && referenced[target.RefID] {
+					// a hidden helper is never drawn and the targets using it have
+					// it inlined, so it does not fail the panel
 					continue
-				} else {
-					newTargetStr, err := g.CirconusClient.Translate(target.Target)
-					if err != nil {
-						logger.Printf(logger.LvlError, "Panel: %s Target: %s %v", panel.Title, target.Target, err)
+				}
+				failed++
+				continue
+			}
+			tres.CAQL = translations[i].CAQL
+			tres.StatsdRewrites = translations[i].StatsdRewrites
+			tres.Series = seriesName(queries[i])
+			tres.Label = caqlLabel(tres.CAQL)
+		}
+		if failed > 0 {
+			switch g.OnFailure {
+			case FailureAbort:
+				return fmt.Errorf("panel %d %q: %d target(s) failed to translate: %w", panel.ID, panel.Title, failed, ErrConversionAborted)
+			case FailureMixed:
+				logger.Printf(logger.LvlWarning, "Panel %d: %s converted to a mixed panel, %d target(s) kept as graphite", panel.ID, panel.Title, failed)
+				panelDatasource := ""
+				if panel.Datasource != nil && !mixed {
+					panelDatasource = *panel.Datasource
+				}
+				for i := range *targets {
+					target := &(*targets)[i]
+					switch {
+					case tresults[i] == nil:
+					case tresults[i].Error != "":
+						// keep the graphite query hidden alongside the converted ones
+						if target.Datasource == "" {
+							target.Datasource = panelDatasource
+						}
+						target.Hide = true
+					default:
+						applyTranslation(target, tresults[i].CAQL)
+						target.Datasource = *ds.circonusRef(targetDatasource(panel, target))
+						res.TargetsChanged++
 					}
-					target.Query = newTargetStr
-					target.Target = ""
-					panel.SetTarget(&target)
 				}
+				panel.Datasource = mixedRef(panel.Datasource)
+				res.PanelsChanged++
+			default:
+				logger.Printf(logger.LvlWarning, "Panel %d: %s left unconverted, %d target(s) failed to translate", panel.ID, panel.Title, failed)
 			}
-		} else {
-			if g.Debug {
-				logger.Printf(logger.LvlInfo, "No targets")
+			g.convertAlert(panel, pres)
+			continue
+		}
+		kept := make([]sdk.Target, 0, len(*targets))
+		for i := range *targets {
+			target := &(*targets)[i]
+			switch {
+			case tresults[i] == nil:
+			case tresults[i].Error != "":
+				// the only failures left are hidden helpers, inlined into every
+				// target using them. Once the panel is on the Circonus datasource
+				// their graphite query has nowhere to run, so they are dropped.
+				if !mixed {
+					logger.Printf(logger.LvlWarning, "Panel %d: %s dropping hidden helper target %s", panel.ID, panel.Title, target.RefID)
+					continue
+				}
+			default:
+				applyTranslation(target, tresults[i].CAQL)
+				if mixed || target.Datasource != "" {
+					target.Datasource = *ds.circonusRef(targetDatasource(panel, target))
+				}
+				res.TargetsChanged++
 			}
+			kept = append(kept, *target)
+		}
+		*targets = kept
+		if !mixed {
+			panel.Datasource = ds.circonusRef(panel.Datasource)
 		}
+		res.PanelsChanged++
+		g.convertAlert(panel, pres)
 	}
 	return nil
 }
 
+// isMixed reports whether a panel datasource reference is to the mixed
+// datasource, whose targets each name their own datasource
+func isMixed(ds *string) bool {
+	ref, _ := parseDatasourceRef(ds)
+	return ref.Name == sdk.MixedSource || ref.UID == sdk.MixedSource
+}
+
+// targetDatasource returns the datasource reference of a target, which is
+// that of its panel when the target has none of its own
+func targetDatasource(panel *sdk.Panel, target *sdk.Target) *string {
+	if target.Datasource != "" || isMixed(panel.Datasource) {
+		return &target.Datasource
+	}
+	return panel.Datasource
+}
+
+// applyTranslation replaces a graphite target with its CAQL translation
+func applyTranslation(target *sdk.Target, caql string) {
+	target.QueryType = "caql"
+	target.Query = caql
+	target.Target = ""
+	target.TargetFull = ""
+}
+
 func contains(strings []string, test string) bool {
 	for _, s := range strings {
 		if s == test {
@@ -0,0 +1,159 @@
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/circonus"
+)
+
+// testGrafana returns a Grafana converting offline against a fake
+// translator, which turns a query q into the CAQL caql(q) and fails the
+// queries containing "fail"
+func testGrafana(t *testing.T) Grafana {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req circonus.TranslateRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := circonus.TranslateResponseBody{Input: req.Query}
+		if strings.Contains(req.Query, "fail") {
+			resp.Error = "cannot translate"
+		} else {
+			resp.CAQL = "caql(" + req.Query + ")"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(srv.URL, "", false, false, &circonus.Client{GraphiteTranslateURL: u, HTTPClient: srv.Client()})
+}
+
+// decodePanels decodes the panels of a dashboard model
+func decodePanels(t *testing.T, raw string) []*sdk.Panel {
+	board, err := DecodeBoard([]byte(raw))
+	if err != nil {
+		t.Fatalf("DecodeBoard() error = %v", err)
+	}
+	return board.Panels
+}
+
+func TestConvertPanelsMixed(t *testing.T) {
+	g := testGrafana(t)
+	panels := decodePanels(t, `{"panels": [{
+		"id": 1, "type": "graph", "title": "mixed", "datasource": "-- Mixed --",
+		"targets": [
+			{"refId": "A", "datasource": "graphite", "target": "a.b"},
+			{"refId": "B", "datasource": "prometheus", "expr": "rate(http_requests_total[5m])"},
+			{"refId": "C", "datasource": "graphite", "target": "scale(#A, 2)"},
+			{"refId": "D", "target": "c.d"}
+		]
+	}]}`)
+	res := &DashboardResult{}
+	if err := g.ConvertPanels(panels, "circonus", []string{"graphite"}, res); err != nil {
+		t.Fatalf("ConvertPanels() error = %v", err)
+	}
+	if ds := panels[0].Datasource; ds == nil || *ds != sdk.MixedSource {
+		t.Errorf("panel datasource = %v, want %s", ds, sdk.MixedSource)
+	}
+	want := []sdk.Target{
+		{RefID: "A", Datasource: "circonus", QueryType: "caql", Query: "caql(a.b)"},
+		{RefID: "B", Datasource: "prometheus", Expr: "rate(http_requests_total[5m])"},
+		{RefID: "C", Datasource: "circonus", QueryType: "caql", Query: "caql(scale(a.b,2))"},
+		// a target without a datasource of a mixed panel is on the default one
+		{RefID: "D", Target: "c.d"},
+	}
+	if got := *panels[0].GetTargets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %+v, want %+v", got, want)
+	}
+	if res.TargetsChanged != 2 || res.PanelsChanged != 1 {
+		t.Errorf("changed %d target(s) of %d panel(s), want 2 of 1", res.TargetsChanged, res.PanelsChanged)
+	}
+}
+
+func TestConvertDashboardsOnFailure(t *testing.T) {
+	const raw = `{"uid": "src", "title": "cpu", "panels": [{
+		"id": 1, "type": "graph", "title": "cpu", "datasource": "graphite",
+		"targets": [
+			{"refId": "A", "target": "a.b"},
+			{"refId": "B", "target": "fail.b"}
+		]
+	}]}`
+	tests := []struct {
+		policy      string
+		wantWritten bool
+		wantDS      string
+		want        []sdk.Target
+	}{
+		{
+			policy:      FailureKeep,
+			wantWritten: true,
+			wantDS:      "graphite",
+			want:        []sdk.Target{{RefID: "A", Target: "a.b"}, {RefID: "B", Target: "fail.b"}},
+		},
+		{
+			policy:      FailureMixed,
+			wantWritten: true,
+			wantDS:      sdk.MixedSource,
+			want: []sdk.Target{
+				{RefID: "A", Datasource: "circonus", QueryType: "caql", Query: "caql(a.b)"},
+				{RefID: "B", Datasource: "graphite", Hide: true, Target: "fail.b"},
+			},
+		},
+		{policy: FailureAbort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			board, err := DecodeBoard([]byte(raw))
+			if err != nil {
+				t.Fatalf("DecodeBoard() error = %v", err)
+			}
+			var out bytes.Buffer
+			g := testGrafana(t)
+			g.OnFailure = tt.policy
+			g.Sink = WriterSink{Writer: &out}
+			results, err := g.ConvertDashboards([]Dashboard{board}, "circonus", sdk.FoundBoard{}, []string{"graphite"})
+			if err != nil {
+				t.Fatalf("ConvertDashboards() error = %v", err)
+			}
+			res := results[0]
+			if len(res.Failures) == 0 {
+				t.Errorf("failures = %v, want the failed target reported", res.Failures)
+			}
+			if res.Written != tt.wantWritten {
+				t.Errorf("written = %v, want %v", res.Written, tt.wantWritten)
+			}
+			if !tt.wantWritten {
+				if last := res.Failures[len(res.Failures)-1]; !strings.Contains(last, ErrConversionAborted.Error()) {
+					t.Errorf("last failure = %q, want the conversion aborted", last)
+				}
+				if out.Len() != 0 {
+					t.Errorf("wrote %s, want nothing", out.String())
+				}
+				return
+			}
+			converted, err := DecodeBoard(out.Bytes())
+			if err != nil {
+				t.Fatalf("DecodeBoard() of the output error = %v", err)
+			}
+			panel := converted.Panels[0]
+			if panel.Datasource == nil || *panel.Datasource != tt.wantDS {
+				t.Errorf("panel datasource = %v, want %s", panel.Datasource, tt.wantDS)
+			}
+			if got := *panel.GetTargets(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package grafana
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// Journal records every dashboard, library panel, folder and permission list
+// written to Grafana so that a run can be rolled back. Entries are appended
+// to a file as JSON lines as soon as the write is done.
+type Journal struct {
+	// RunID identifies the entries written by this run
+	RunID string
+	path  string
+	mu    sync.Mutex
+}
+
+// Kinds of journal entries other than dashboard writes
+const (
+	JournalLibraryPanel         = "library_panel"
+	JournalFolder               = "folder"
+	JournalDashboardPermissions = "dashboard_permissions"
+	JournalFolderPermissions    = "folder_permissions"
+)
+
+// JournalEntry records a single write
+type JournalEntry struct {
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+	// Kind is what was written, a dashboard when empty
+	Kind      string `json:"kind,omitempty"`
+	SourceUID string `json:"source_uid"`
+	DestUID   string `json:"dest_uid"`
+	Title     string `json:"title"`
+	// PreviousVersion is the version the destination dashboard had before
+	// it was written, 0 if it was created
+	PreviousVersion uint `json:"previous_version"`
+	// Previous is the library panel or the permission list as it was
+	// before it was written, absent for a library panel that was created
+	Previous json.RawMessage `json:"previous,omitempty"`
+}
+
+// IsDashboard reports whether the entry records a dashboard write
+func (e JournalEntry) IsDashboard() bool {
+	return e.Kind == ""
+}
+
+// describe names what the entry records a write of, for logs
+func (e JournalEntry) describe() string {
+	switch e.Kind {
+	case JournalLibraryPanel:
+		return fmt.Sprintf("library panel %s (%s)", e.DestUID, e.Title)
+	case JournalFolder:
+		return fmt.Sprintf("folder %s (%s)", e.DestUID, e.Title)
+	case JournalDashboardPermissions:
+		return fmt.Sprintf("permissions of dashboard %s (%s)", e.DestUID, e.Title)
+	case JournalFolderPermissions:
+		return fmt.Sprintf("permissions of folder %s (%s)", e.DestUID, e.Title)
+	}
+	return fmt.Sprintf("dashboard %s (%s)", e.DestUID, e.Title)
+}
+
+// NewJournal creates a journal appending to path under a new run ID
+func NewJournal(path string) *Journal {
+	return &Journal{RunID: newRunID(time.Now()), path: path}
+}
+
+// newRunID returns a run ID made of the start time of the run and a random
+// suffix, so that runs started at the same time get their own ID
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		binary.BigEndian.PutUint16(suffix, uint16(os.Getpid()))
+	}
+	return fmt.Sprintf("%s-%x", now.UTC().Format("20060102T150405.000Z"), suffix)
+}
+
+// Record appends an entry for a dashboard written by this run
+func (j *Journal) Record(e JournalEntry) error {
+	e.RunID = j.RunID
+	e.Time = time.Now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error marshaling journal entry: %w", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening journal: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+	return f.Close()
+}
+
+// record appends an entry to the journal of the run, if there is one
+func (g Grafana) record(e JournalEntry) error {
+	if g.Journal == nil {
+		return nil
+	}
+	return g.Journal.Record(e)
+}
+
+// ReadJournal reads every entry of the journal stored in path, oldest first
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	defer f.Close()
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("error parsing journal %s line %d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	return entries, nil
+}
+
+// dashboardVersion returns the current version of a dashboard, 0 if it does
+// not exist
+func (g Grafana) dashboardVersion(ctx context.Context, uid string) (uint, error) {
+	var resp struct {
+		Meta struct {
+			Version uint `json:"version"`
+		} `json:"meta"`
+		Dashboard struct {
+			Version uint `json:"version"`
+		} `json:"dashboard"`
+	}
+	err := g.apiRequest(ctx, http.MethodGet, "api/dashboards/uid/"+uid, nil, &resp)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching dashboard %s: %w", uid, err)
+	}
+	if resp.Meta.Version != 0 {
+		return resp.Meta.Version, nil
+	}
+	return resp.Dashboard.Version, nil
+}
+
+// Rollback undoes the writes recorded in entries, newest first. Dashboards
+// that were created are deleted and the others are restored to the version
+// they had before through the dashboard versions API. Library panels and
+// permission lists are put back as they were, library panels that were
+// created are deleted, and so are the folders that were created once they
+// are empty again. Every entry is attempted, the UIDs of the deleted
+// dashboards are returned along with the first error.
+func (g Grafana) Rollback(ctx context.Context, entries []JournalEntry) ([]string, error) {
+	var deleted []string
+	var firstErr error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		var err error
+		switch e.Kind {
+		case JournalLibraryPanel:
+			err = g.rollbackLibraryPanel(ctx, e)
+		case JournalFolder:
+			err = g.rollbackFolder(ctx, e)
+		case JournalDashboardPermissions, JournalFolderPermissions:
+			err = g.rollbackPermissions(ctx, e)
+		default:
+			var gone bool
+			if gone, err = g.rollbackDashboard(ctx, e); gone {
+				deleted = append(deleted, e.DestUID)
+			}
+		}
+		if err != nil {
+			logger.Printf(logger.LvlError, "Rolling back %s: %v", e.describe(), err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error rolling back %s: %w", e.describe(), err)
+			}
+		}
+	}
+	return deleted, firstErr
+}
+
+// rollbackDashboard deletes a dashboard the run created or restores the
+// version it replaced, reporting whether it was deleted
+func (g Grafana) rollbackDashboard(ctx context.Context, e JournalEntry) (bool, error) {
+	switch {
+	case g.DryRun && e.PreviousVersion == 0:
+		logger.Printf(logger.LvlInfo, "Dry run, not deleting %s", e.describe())
+		return false, nil
+	case g.DryRun:
+		logger.Printf(logger.LvlInfo, "Dry run, not restoring %s to version %d", e.describe(), e.PreviousVersion)
+		return false, nil
+	case e.PreviousVersion == 0:
+		if err := g.deleteIfExists(ctx, "api/dashboards/uid/"+e.DestUID); err != nil {
+			return false, err
+		}
+		logger.Printf(logger.LvlInfo, "Deleted %s", e.describe())
+		return true, nil
+	}
+	body := map[string]uint{"version": e.PreviousVersion}
+	if err := g.apiRequest(ctx, http.MethodPost, "api/dashboards/uid/"+e.DestUID+"/restore", body, nil); err != nil {
+		return false, err
+	}
+	logger.Printf(logger.LvlInfo, "Restored %s to version %d", e.describe(), e.PreviousVersion)
+	return false, nil
+}
+
+// rollbackLibraryPanel deletes a library panel the run created or puts back
+// the model, name and folder it had before
+func (g Grafana) rollbackLibraryPanel(ctx context.Context, e JournalEntry) error {
+	if len(e.Previous) == 0 {
+		if g.DryRun {
+			logger.Printf(logger.LvlInfo, "Dry run, not deleting %s", e.describe())
+			return nil
+		}
+		// the dashboards using it were rolled back first, so that Grafana
+		// lets it go
+		if err := g.deleteIfExists(ctx, "api/library-elements/"+url.PathEscape(e.DestUID)); err != nil {
+			return err
+		}
+		logger.Printf(logger.LvlInfo, "Deleted %s", e.describe())
+		return nil
+	}
+	var prev libraryElement
+	if err := json.Unmarshal(e.Previous, &prev); err != nil {
+		return fmt.Errorf("error parsing the previous library panel: %w", err)
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not restoring %s", e.describe())
+		return nil
+	}
+	current, err := g.libraryElement(ctx, e.DestUID)
+	if err != nil {
+		return err
+	}
+	prev.Version = current.Version
+	if err := g.apiRequest(ctx, http.MethodPatch, "api/library-elements/"+url.PathEscape(e.DestUID), prev, nil); err != nil {
+		return err
+	}
+	logger.Printf(logger.LvlInfo, "Restored %s", e.describe())
+	return nil
+}
+
+// rollbackFolder deletes a folder the run created. Deleting a folder deletes
+// what it holds, so folders holding anything are left alone.
+func (g Grafana) rollbackFolder(ctx context.Context, e JournalEntry) error {
+	var folder Folder
+	err := g.apiRequest(ctx, http.MethodGet, "api/folders/"+url.PathEscape(e.DestUID), nil, &folder)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	folder.Path = e.Title
+	children, err := g.SubFolders(ctx, folder)
+	if err != nil {
+		return err
+	}
+	boards, err := g.Client.Search(ctx, sdk.SearchType(sdk.SearchTypeDashboard), sdk.SearchFolderID(int(folder.ID)), sdk.SearchLimit(1))
+	if err != nil {
+		return fmt.Errorf("error searching dashboards: %w", err)
+	}
+	if len(children)+len(boards) > 0 {
+		return errors.New("the folder is not empty, not deleting it")
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not deleting %s", e.describe())
+		return nil
+	}
+	if err := g.deleteIfExists(ctx, "api/folders/"+url.PathEscape(e.DestUID)); err != nil {
+		return err
+	}
+	logger.Printf(logger.LvlInfo, "Deleted %s", e.describe())
+	return nil
+}
+
+// rollbackPermissions puts back the permissions a dashboard or folder had
+// before the run set them. Those of dashboards and folders deleted since
+// have nothing to restore.
+func (g Grafana) rollbackPermissions(ctx context.Context, e JournalEntry) error {
+	var prev []Permission
+	if err := json.Unmarshal(e.Previous, &prev); err != nil {
+		return fmt.Errorf("error parsing the previous permissions: %w", err)
+	}
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not restoring %s", e.describe())
+		return nil
+	}
+	apiPath := "api/dashboards/uid/" + url.PathEscape(e.DestUID) + "/permissions"
+	if e.Kind == JournalFolderPermissions {
+		apiPath = "api/folders/" + url.PathEscape(e.DestUID) + "/permissions"
+	}
+	body := map[string][]permissionItem{"items": permissionItems(prev)}
+	err := g.apiRequest(ctx, http.MethodPost, apiPath, body, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Printf(logger.LvlInfo, "Restored %s: %d permission(s)", e.describe(), len(prev))
+	return nil
+}
+
+// deleteIfExists deletes what apiPath stands for, taking it being gone
+// already as success
+func (g Grafana) deleteIfExists(ctx context.Context, apiPath string) error {
+	err := g.apiRequest(ctx, http.MethodDelete, apiPath, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,322 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// libraryPanelKind is the kind of library elements that are panels
+const libraryPanelKind = 1
+
+// LibraryPanelResult records the conversion of a library panel used by a
+// dashboard
+type LibraryPanelResult struct {
+	UID            string           `json:"uid"`
+	Name           string           `json:"name"`
+	NewUID         string           `json:"new_uid,omitempty"`
+	NewName        string           `json:"new_name,omitempty"`
+	TargetsChanged int              `json:"targets_changed"`
+	Panel          *PanelResult     `json:"panel,omitempty"`
+	Migration      *MigrationResult `json:"migration,omitempty"`
+	Failures       []string         `json:"failures,omitempty"`
+	Unsupported    string           `json:"unsupported,omitempty"`
+}
+
+// libraryElement is a library panel as the library elements API has it
+type libraryElement struct {
+	UID       string          `json:"uid"`
+	Name      string          `json:"name"`
+	Kind      int             `json:"kind"`
+	FolderUID string          `json:"folderUid"`
+	Model     json.RawMessage `json:"model"`
+	Version   int             `json:"version,omitempty"`
+}
+
+// libraryPanels holds the library panels converted during a run, so that
+// each is converted once whatever the number of dashboards using it, even
+// when those are converted concurrently
+type libraryPanels struct {
+	mu        sync.Mutex
+	converted map[string]*libraryPanelOnce
+}
+
+// libraryPanelOnce converts a library panel the first time it is needed
+type libraryPanelOnce struct {
+	once sync.Once
+	lp   *libraryPanel
+}
+
+// libraryPanel is a converted library panel
+type libraryPanel struct {
+	res *LibraryPanelResult
+	// err is set when the dashboards using the panel are not to be written
+	err error
+	// el is the converted library panel, saved along with the first
+	// dashboard using it that is written
+	el       *libraryElement
+	saveOnce sync.Once
+	saveErr  error
+}
+
+func newLibraryPanels() *libraryPanels {
+	return &libraryPanels{converted: make(map[string]*libraryPanelOnce)}
+}
+
+// get returns the converted library panel, converting it with convert if
+// no dashboard needed it before
+func (l *libraryPanels) get(uid string, convert func() *libraryPanel) *libraryPanel {
+	l.mu.Lock()
+	o, ok := l.converted[uid]
+	if !ok {
+		o = &libraryPanelOnce{}
+		l.converted[uid] = o
+	}
+	l.mu.Unlock()
+	o.once.Do(func() { o.lp = convert() })
+	return o.lp
+}
+
+// lookup returns the library panel converted earlier in the run, or nil.
+// Dashboards are written once all of them are converted, so the conversion
+// is over by the time a dashboard being written looks it up.
+func (l *libraryPanels) lookup(uid string) *libraryPanel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if o, ok := l.converted[uid]; ok {
+		return o.lp
+	}
+	return nil
+}
+
+// libraryPanelUIDs returns the UIDs of the library panels a dashboard uses
+func (d Dashboard) libraryPanelUIDs() ([]string, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	model, err := decodeModel(raw)
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	forEachPanel(model, func(panel map[string]interface{}) {
+		ref, _ := panel["libraryPanel"].(map[string]interface{})
+		if uid, _ := ref["uid"].(string); uid != "" && !contains(uids, uid) {
+			uids = append(uids, uid)
+		}
+	})
+	return uids, nil
+}
+
+// libraryElement fetches a library panel
+func (g Grafana) libraryElement(ctx context.Context, uid string) (libraryElement, error) {
+	var resp struct {
+		Result libraryElement `json:"result"`
+	}
+	err := g.apiRequest(ctx, http.MethodGet, "api/library-elements/"+uid, nil, &resp)
+	return resp.Result, err
+}
+
+// saveLibraryElement creates a library panel converted from the one with
+// sourceUID, or updates it if one with the same UID exists, recording what
+// it replaces in the journal
+func (g Grafana) saveLibraryElement(ctx context.Context, sourceUID string, el libraryElement) error {
+	entry := JournalEntry{Kind: JournalLibraryPanel, SourceUID: sourceUID, DestUID: el.UID, Title: el.Name}
+	existing, err := g.libraryElement(ctx, el.UID)
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		el.Version = 0
+		if err := g.apiRequest(ctx, http.MethodPost, "api/library-elements", el, nil); err != nil {
+			return err
+		}
+		return g.record(entry)
+	case err != nil:
+		return err
+	}
+	if entry.Previous, err = json.Marshal(existing); err != nil {
+		return err
+	}
+	el.Version = existing.Version
+	if err := g.apiRequest(ctx, http.MethodPatch, "api/library-elements/"+el.UID, el, nil); err != nil {
+		return err
+	}
+	return g.record(entry)
+}
+
+// convertLibraryPanels converts the library panels a dashboard uses. Copies
+// of converted dashboards are relinked to converted copies of the library
+// panels, to be created in the destination folder, while in place
+// conversions update the library panels themselves. Library panels live in
+// Grafana, so they are only converted when writing to Grafana, and are only
+// saved by saveLibraryPanels once a dashboard using them is written.
+func (g Grafana) convertLibraryPanels(board *Dashboard, dss *datasourceSet, destinationFolder Folder, res *DashboardResult) error {
+	uids, err := board.libraryPanelUIDs()
+	if err != nil || len(uids) == 0 {
+		return err
+	}
+	if _, toGrafana := g.Sink.(GrafanaSink); !toGrafana {
+		for _, uid := range uids {
+			lres := &LibraryPanelResult{UID: uid, Unsupported: "library panels are only converted when writing to Grafana"}
+			res.LibraryPanels = append(res.LibraryPanels, lres)
+			logger.Printf(logger.LvlWarning, "Library panel %s: %s", uid, lres.Unsupported)
+		}
+		return nil
+	}
+	libraries := g.libraries
+	if libraries == nil {
+		libraries = newLibraryPanels()
+	}
+
+	relink := make(map[string]*LibraryPanelResult)
+	for _, uid := range uids {
+		lp := libraries.get(uid, func() *libraryPanel {
+			return g.convertLibraryPanel(uid, dss, destinationFolder)
+		})
+		res.LibraryPanels = append(res.LibraryPanels, lp.res)
+		for _, f := range lp.res.Failures {
+			res.addFailure("library panel %s: %s", lp.res.Name, f)
+		}
+		if lp.err != nil {
+			return fmt.Errorf("library panel %s: %w", lp.res.Name, lp.err)
+		}
+		if lp.res.NewUID != "" && lp.res.NewUID != uid {
+			relink[uid] = lp.res
+		}
+	}
+	if len(relink) == 0 {
+		return nil
+	}
+	return board.editModel(func(model map[string]interface{}) error {
+		forEachPanel(model, func(panel map[string]interface{}) {
+			ref, _ := panel["libraryPanel"].(map[string]interface{})
+			uid, _ := ref["uid"].(string)
+			if lres, ok := relink[uid]; ok {
+				ref["uid"] = lres.NewUID
+				ref["name"] = lres.NewName
+			}
+		})
+		return nil
+	})
+}
+
+// convertLibraryPanel converts a library panel, leaving the result to be
+// saved by saveLibraryPanels
+func (g Grafana) convertLibraryPanel(uid string, dss *datasourceSet, destinationFolder Folder) *libraryPanel {
+	ctx := context.Background()
+	lres := &LibraryPanelResult{UID: uid, Name: uid}
+	lp := &libraryPanel{res: lres}
+	el, err := g.libraryElement(ctx, uid)
+	if err != nil {
+		lres.Failures = append(lres.Failures, fmt.Sprintf("reading library panel: %v", err))
+		logger.Printf(logger.LvlError, "Library panel %s: %v", uid, err)
+		return lp
+	}
+	lres.Name = el.Name
+	logger.Printf(logger.LvlInfo, "Converting Library Panel %s: %s", uid, el.Name)
+
+	// the panel is converted as the only panel of a dashboard
+	board, err := DecodeBoard([]byte(`{"panels":[` + string(el.Model) + `]}`))
+	if err != nil {
+		lres.Failures = append(lres.Failures, fmt.Sprintf("decoding library panel: %v", err))
+		return lp
+	}
+	pres := &DashboardResult{}
+	err = g.convertPanels(board.Panels, dss.forBoard(nil), pres)
+	lres.Failures = append(lres.Failures, pres.Failures...)
+	lres.TargetsChanged = pres.TargetsChanged
+	if len(pres.Panels) > 0 {
+		lres.Panel = pres.Panels[0]
+	}
+	if err != nil {
+		if errors.Is(err, ErrConversionAborted) {
+			lp.err = err
+		}
+		return lp
+	}
+	if pres.PanelsChanged == 0 {
+		return lp
+	}
+	if err := board.renameSeries(pres.Panels); err != nil {
+		lres.Failures = append(lres.Failures, fmt.Sprintf("renaming series: %v", err))
+		return lp
+	}
+	if g.MigratePanels {
+		if err := g.migratePanels(&board, pres); err != nil {
+			lres.Failures = append(lres.Failures, fmt.Sprintf("migrating library panel: %v", err))
+			return lp
+		}
+		if len(pres.Migrations) > 0 {
+			lres.Migration = pres.Migrations[0]
+		}
+	}
+
+	model, err := board.panelModel()
+	if err != nil {
+		lres.Failures = append(lres.Failures, err.Error())
+		return lp
+	}
+	newEl := libraryElement{UID: uid, Name: el.Name, Kind: libraryPanelKind, FolderUID: el.FolderUID, Model: model}
+	if !g.InPlace {
+		newEl.UID = DeriveUID(uid)
+		newEl.FolderUID = destinationFolder.UID
+		if newEl.Name, err = g.renderTitle(TitleData{Title: el.Name, UID: uid, Folder: destinationFolder.Path}); err != nil {
+			lres.Failures = append(lres.Failures, err.Error())
+			return lp
+		}
+	}
+	lres.NewUID = newEl.UID
+	lres.NewName = newEl.Name
+	lp.el = &newEl
+	return lp
+}
+
+// saveLibraryPanels writes the converted library panels a dashboard uses
+// before the dashboard itself is written. Each library panel is written
+// once per run, by the first dashboard using it that gets written, and the
+// others wait for it.
+func (g Grafana) saveLibraryPanels(res *DashboardResult) error {
+	if g.libraries == nil {
+		return nil
+	}
+	for _, lres := range res.LibraryPanels {
+		lp := g.libraries.lookup(lres.UID)
+		if lp == nil || lp.el == nil {
+			continue
+		}
+		lp.saveOnce.Do(func() {
+			if lp.saveErr = g.saveLibraryElement(context.Background(), lres.UID, *lp.el); lp.saveErr != nil {
+				logger.Printf(logger.LvlError, "Library panel %s: %v", lres.Name, lp.saveErr)
+				return
+			}
+			logger.Printf(logger.LvlInfo, "Wrote library panel %s", lp.el.Name)
+		})
+		if lp.saveErr != nil {
+			return fmt.Errorf("writing library panel %s: %w", lres.Name, lp.saveErr)
+		}
+	}
+	return nil
+}
+
+// panelModel returns the JSON model of the first panel of a dashboard
+func (d Dashboard) panelModel() (json.RawMessage, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	model, err := decodeModel(raw)
+	if err != nil {
+		return nil, err
+	}
+	panels, _ := model["panels"].([]interface{})
+	if len(panels) == 0 {
+		return nil, errors.New("library panel model has no panel")
+	}
+	return json.Marshal(panels[0])
+}
@@ -0,0 +1,120 @@
+package grafana
+
+import (
+	"regexp"
+
+	"github.com/bdunavant/sdk"
+)
+
+// linkTarget is where links to a converted dashboard should point
+type linkTarget struct {
+	UID string
+	// Slug is empty for copies converted by earlier runs
+	Slug string
+}
+
+// linkMap maps source dashboards to their converted copies, by UID and by
+// the slug legacy links use
+type linkMap struct {
+	byUID  map[string]linkTarget
+	bySlug map[string]linkTarget
+}
+
+// dashboardURLRe matches the dashboard part of dashboard URLs such as
+// /d/<uid>/<slug>, d-solo/<uid> or https://grafana/d/<uid>/<slug>?orgId=1
+var dashboardURLRe = regexp.MustCompile(`(^|/)(d|d-solo)/([A-Za-z0-9_-]+)(/[^/?#]*)?`)
+
+// legacyURLRe matches the dashboard part of pre UID dashboard URLs such as
+// /dashboard/db/<slug>
+var legacyURLRe = regexp.MustCompile(`(^|/)dashboard/db/([^/?#]+)`)
+
+// newLinkMap creates a link map knowing the copies recorded in the UID map
+func (g Grafana) newLinkMap() *linkMap {
+	m := &linkMap{byUID: make(map[string]linkTarget), bySlug: make(map[string]linkTarget)}
+	for _, src := range g.UIDMap.Sources() {
+		dst, _ := g.UIDMap.Lookup(src)
+		m.byUID[src] = linkTarget{UID: dst}
+	}
+	return m
+}
+
+// addCopy records the copy a source dashboard converted into folder gets
+func (g Grafana) addCopy(m *linkMap, src Dashboard, folder string) {
+	if src.UID == "" {
+		return
+	}
+	title, err := g.copyTitle(src, folder)
+	if err != nil {
+		// reported when the dashboard itself is converted
+		return
+	}
+	dst := linkTarget{UID: g.UIDMap.DestUID(src.UID), Slug: slugOf(title)}
+	m.byUID[src.UID] = dst
+	m.bySlug[slugOf(src.Title)] = dst
+}
+
+// slugOf returns the slug Grafana uses in URLs for a dashboard title
+func slugOf(title string) string {
+	b := sdk.Board{Title: title}
+	return b.UpdateSlug()
+}
+
+// rewriteURL points a dashboard URL at the converted copy of the dashboard
+// it refers to, reporting whether it was changed
+func (m *linkMap) rewriteURL(u string) (string, bool) {
+	changed := false
+	u = dashboardURLRe.ReplaceAllStringFunc(u, func(match string) string {
+		parts := dashboardURLRe.FindStringSubmatch(match)
+		dst, ok := m.byUID[parts[3]]
+		if !ok {
+			return match
+		}
+		changed = true
+		slug := parts[4]
+		if slug != "" && slug != "/" && dst.Slug != "" {
+			slug = "/" + dst.Slug
+		}
+		return parts[1] + parts[2] + "/" + dst.UID + slug
+	})
+	u = legacyURLRe.ReplaceAllStringFunc(u, func(match string) string {
+		parts := legacyURLRe.FindStringSubmatch(match)
+		dst, ok := m.bySlug[parts[2]]
+		if !ok {
+			return match
+		}
+		changed = true
+		return parts[1] + "d/" + dst.UID + "/" + dst.Slug
+	})
+	return u, changed
+}
+
+// rewriteLinks points the dashboard links, panel links and data links of a
+// dashboard model that refer to converted dashboards at their copies and
+// returns the number of links changed. Every url or linkUrl value is looked
+// at, which covers the links of table-old column styles too.
+func (m *linkMap) rewriteLinks(model map[string]interface{}) int {
+	changed := 0
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k, child := range val {
+				s, ok := child.(string)
+				if ok && (k == "url" || k == "linkUrl") {
+					if u, ok := m.rewriteURL(s); ok {
+						val[k] = u
+						changed++
+					}
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range val {
+				walk(child)
+			}
+		}
+	}
+	walk(model)
+	return changed
+}
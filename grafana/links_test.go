@@ -0,0 +1,46 @@
+package grafana
+
+import "testing"
+
+func TestRewriteURL(t *testing.T) {
+	m := &linkMap{
+		byUID: map[string]linkTarget{
+			"src1": {UID: "dst1", Slug: "cpu-circonus"},
+			// copied by an earlier run, whose slug is not known
+			"src2": {UID: "dst2"},
+		},
+		bySlug: map[string]linkTarget{
+			"cpu": {UID: "dst1", Slug: "cpu-circonus"},
+		},
+	}
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		changed bool
+	}{
+		{"relative", "/d/src1/cpu", "/d/dst1/cpu-circonus", true},
+		{"relative without leading slash", "d/src1/cpu", "d/dst1/cpu-circonus", true},
+		{"absolute", "https://grafana.example.com/d/src1/cpu", "https://grafana.example.com/d/dst1/cpu-circonus", true},
+		{"absolute under a sub path", "https://example.com/grafana/d/src1/cpu", "https://example.com/grafana/d/dst1/cpu-circonus", true},
+		{"no slug", "/d/src1", "/d/dst1", true},
+		{"trailing slash", "/d/src1/", "/d/dst1/", true},
+		{"solo panel", "/d-solo/src1/cpu?panelId=2", "/d-solo/dst1/cpu-circonus?panelId=2", true},
+		{"query string", "/d/src1/cpu?orgId=1&var-host=$host", "/d/dst1/cpu-circonus?orgId=1&var-host=$host", true},
+		{"fragment", "/d/src1/cpu#panel-2", "/d/dst1/cpu-circonus#panel-2", true},
+		{"query string and fragment", "https://grafana/d/src1/cpu?orgId=1#panel-2", "https://grafana/d/dst1/cpu-circonus?orgId=1#panel-2", true},
+		{"copy of unknown slug keeps the slug", "/d/src2/mem?orgId=1", "/d/dst2/mem?orgId=1", true},
+		{"legacy url", "/dashboard/db/cpu?orgId=1", "/d/dst1/cpu-circonus?orgId=1", true},
+		{"dashboard outside the run", "/d/other/disk?orgId=1", "/d/other/disk?orgId=1", false},
+		{"legacy url outside the run", "/dashboard/db/disk", "/dashboard/db/disk", false},
+		{"not a dashboard", "https://example.com/docs/d", "https://example.com/docs/d", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := m.rewriteURL(tt.url)
+			if got != tt.want || changed != tt.changed {
+				t.Errorf("rewriteURL(%q) = %q, %v, want %q, %v", tt.url, got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
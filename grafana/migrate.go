@@ -0,0 +1,802 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migratedPluginVersion is the plugin version recorded on migrated panels.
+// Their options are written in the shape of that version, later versions of
+// Grafana migrate them further when the dashboard is loaded.
+const migratedPluginVersion = "8.0.0"
+
+// MigrationResult records the migration of a deprecated panel
+type MigrationResult struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+	From  string `json:"from"`
+	To    string `json:"to,omitempty"`
+	// Dropped lists the settings the new panel has no equivalent for
+	Dropped []string `json:"dropped,omitempty"`
+	// Skipped tells why the panel was left as it was
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// panelKeys are the panel keys shared by every panel type, kept when a
+// panel is migrated
+var panelKeys = []string{
+	"id", "type", "title", "description", "datasource", "targets", "gridPos",
+	"span", "height", "links", "transparent", "repeat", "repeatDirection",
+	"maxPerRow", "timeFrom", "timeShift", "hideTimeOverride", "interval",
+	"maxDataPoints", "cacheTimeout", "libraryPanel", "transformations",
+	"fieldConfig", "options", "scopedVars",
+}
+
+// reducers maps the value names of singlestat panels and the aggregation
+// columns of table-old panels to field reducers
+var reducers = map[string]string{
+	"current":   "lastNotNull",
+	"last_time": "lastNotNull",
+	"avg":       "mean",
+	"min":       "min",
+	"max":       "max",
+	"total":     "sum",
+	"first":     "firstNotNull",
+	"delta":     "delta",
+	"diff":      "diff",
+	"range":     "range",
+	"count":     "count",
+}
+
+// thresholdColors maps the color modes of graph thresholds to colors
+var thresholdColors = map[string]string{
+	"critical": "red",
+	"warning":  "orange",
+	"ok":       "green",
+}
+
+// migratePanels upgrades the graph, singlestat and table-old panels of a
+// dashboard to timeseries, stat (or gauge) and table panels
+func (g Grafana) migratePanels(board *Dashboard, res *DashboardResult) error {
+	return board.editModel(func(model map[string]interface{}) error {
+		forEachPanel(model, func(panel map[string]interface{}) {
+			if m := migratePanel(panel); m != nil {
+				res.Migrations = append(res.Migrations, m)
+			}
+		})
+		return nil
+	})
+}
+
+// migratePanel migrates a single panel model, returning nil for panels of
+// other types
+func migratePanel(panel map[string]interface{}) *MigrationResult {
+	from, _ := panel["type"].(string)
+	m := &MigrationResult{From: from, Title: str(panel["title"])}
+	if id, ok := num(panel["id"]); ok {
+		m.ID = uint(id)
+	}
+	if _, ok := panel["libraryPanel"]; ok {
+		// the library panel holds the panel model
+		return nil
+	}
+	switch from {
+	case "graph":
+		if _, ok := panel["alert"]; ok {
+			m.Skipped = "legacy alerts only run on graph panels"
+			return m
+		}
+		if mode := str(obj(panel, "xaxis")["mode"]); mode != "" && mode != "time" {
+			m.Skipped = fmt.Sprintf("the %s x axis mode has no timeseries equivalent", mode)
+			return m
+		}
+		m.To = "timeseries"
+		migrateGraph(panel, m)
+	case "singlestat":
+		m.To = "stat"
+		if boolOf(obj(panel, "gauge")["show"]) {
+			m.To = "gauge"
+		}
+		migrateSinglestat(panel, m)
+	case "table-old":
+		if str(panel["transform"]) == "json" {
+			m.Skipped = "the json data transform has no table equivalent"
+			return m
+		}
+		m.To = "table"
+		migrateTableOld(panel, m)
+	default:
+		return nil
+	}
+	for k := range panel {
+		if !contains(panelKeys, k) {
+			delete(panel, k)
+		}
+	}
+	panel["type"] = m.To
+	panel["pluginVersion"] = migratedPluginVersion
+	return m
+}
+
+// fieldConfig returns the field config defaults of a panel and its custom
+// part, creating them as needed
+func fieldConfig(panel map[string]interface{}) (defaults, custom map[string]interface{}) {
+	fc := ensureObj(panel, "fieldConfig")
+	defaults = ensureObj(fc, "defaults")
+	if _, ok := fc["overrides"].([]interface{}); !ok {
+		fc["overrides"] = []interface{}{}
+	}
+	return defaults, ensureObj(defaults, "custom")
+}
+
+// addOverride adds properties to the field override matching a series name
+// or a /regex/, creating the override as needed
+func addOverride(panel map[string]interface{}, name string, props ...map[string]interface{}) {
+	if len(props) == 0 {
+		return
+	}
+	fieldConfig(panel)
+	fc := obj(panel, "fieldConfig")
+	overrides, _ := fc["overrides"].([]interface{})
+	matcher := map[string]interface{}{"id": "byName", "options": name}
+	if isSeriesRegex(name) {
+		matcher["id"] = "byRegexp"
+	}
+	for _, o := range overrides {
+		override, _ := o.(map[string]interface{})
+		om, _ := override["matcher"].(map[string]interface{})
+		if om["id"] == matcher["id"] && om["options"] == name {
+			list, _ := override["properties"].([]interface{})
+			for _, p := range props {
+				list = append(list, p)
+			}
+			override["properties"] = list
+			return
+		}
+	}
+	var list []interface{}
+	for _, p := range props {
+		list = append(list, p)
+	}
+	fc["overrides"] = append(overrides, map[string]interface{}{"matcher": matcher, "properties": list})
+}
+
+// property is a field override property
+func property(id string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"id": id, "value": value}
+}
+
+// fixedColor is the color of a series drawn in a single color
+func fixedColor(color string) map[string]interface{} {
+	return map[string]interface{}{"mode": "fixed", "fixedColor": color}
+}
+
+// migrateGraph maps the settings of a graph panel onto a timeseries panel.
+// Settings left out of the panel take the defaults of graph panels.
+func migrateGraph(panel map[string]interface{}, m *MigrationResult) {
+	defaults, custom := fieldConfig(panel)
+
+	custom["drawStyle"] = graphDrawStyle(panel["lines"], panel["bars"], panel["points"])
+	custom["lineWidth"] = 1
+	if w, ok := num(panel["linewidth"]); ok {
+		custom["lineWidth"] = w
+	}
+	custom["fillOpacity"] = 10
+	if fill, ok := num(panel["fill"]); ok {
+		custom["fillOpacity"] = fill * 10
+	}
+	custom["gradientMode"] = "none"
+	if gradient, ok := num(panel["fillGradient"]); ok && gradient > 0 {
+		custom["gradientMode"] = "opacity"
+	}
+	custom["showPoints"] = "never"
+	if boolOf(panel["points"]) {
+		custom["showPoints"] = "always"
+	}
+	custom["pointSize"] = 5
+	if r, ok := num(panel["pointradius"]); ok {
+		custom["pointSize"] = r * 2
+	}
+	custom["lineInterpolation"] = "linear"
+	if boolOf(panel["steppedLine"]) {
+		custom["lineInterpolation"] = "stepAfter"
+	}
+	if boolOf(panel["dashes"]) {
+		custom["lineStyle"] = dashStyle(panel)
+	}
+	switch str(panel["nullPointMode"]) {
+	case "connected":
+		custom["spanNulls"] = true
+	case "null as zero":
+		m.Dropped = append(m.Dropped, "null as zero")
+	}
+	stacking := map[string]interface{}{"mode": "none", "group": "A"}
+	if boolOf(panel["stack"]) {
+		stacking["mode"] = "normal"
+		if boolOf(panel["percentage"]) {
+			stacking["mode"] = "percent"
+		}
+	}
+	custom["stacking"] = stacking
+
+	yaxes, _ := panel["yaxes"].([]interface{})
+	if len(yaxes) > 0 {
+		left, _ := yaxes[0].(map[string]interface{})
+		for k, v := range axisSettings(left) {
+			if k == "unit" || k == "min" || k == "max" {
+				defaults[k] = v
+			} else {
+				custom[k] = v
+			}
+		}
+	}
+	if d, ok := num(panel["decimals"]); ok {
+		defaults["decimals"] = d
+	}
+	if steps, style := graphThresholds(panel, m); len(steps) > 0 {
+		defaults["thresholds"] = map[string]interface{}{"mode": "absolute", "steps": steps}
+		custom["thresholdsStyle"] = map[string]interface{}{"mode": style}
+	}
+
+	// series colors and overrides, in the order graph panels apply them
+	aliasColors, _ := panel["aliasColors"].(map[string]interface{})
+	aliases := make([]string, 0, len(aliasColors))
+	for alias := range aliasColors {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if color := str(aliasColors[alias]); color != "" {
+			addOverride(panel, alias, property("color", fixedColor(color)))
+		}
+	}
+	overrides, _ := panel["seriesOverrides"].([]interface{})
+	for _, o := range overrides {
+		so, _ := o.(map[string]interface{})
+		alias := str(so["alias"])
+		if alias == "" {
+			continue
+		}
+		addOverride(panel, alias, seriesOverrideProps(so, yaxes, m)...)
+	}
+
+	options := ensureObj(panel, "options")
+	options["legend"] = graphLegend(obj(panel, "legend"))
+	tooltip := obj(panel, "tooltip")
+	mode := "single"
+	if tooltip["shared"] == nil || boolOf(tooltip["shared"]) {
+		mode = "multi"
+	}
+	sortOrder := "none"
+	if s, _ := num(tooltip["sort"]); s == 1 {
+		sortOrder = "asc"
+	} else if s == 2 {
+		sortOrder = "desc"
+	}
+	options["tooltip"] = map[string]interface{}{"mode": mode, "sort": sortOrder}
+	if regions, _ := panel["timeRegions"].([]interface{}); len(regions) > 0 {
+		m.Dropped = append(m.Dropped, "time regions")
+	}
+}
+
+// graphDrawStyle returns the draw style of series drawn with the given graph
+// lines, bars and points settings
+func graphDrawStyle(lines, bars, points interface{}) string {
+	switch {
+	case boolOf(bars):
+		return "bars"
+	case lines != nil && !boolOf(lines) && boolOf(points):
+		return "points"
+	}
+	return "line"
+}
+
+// dashStyle returns the line style of a graph panel drawing dashes
+func dashStyle(settings map[string]interface{}) map[string]interface{} {
+	dash, ok := num(settings["dashLength"])
+	if !ok {
+		dash = 10
+	}
+	space, ok := num(settings["spaceLength"])
+	if !ok {
+		space = 10
+	}
+	return map[string]interface{}{"fill": "dash", "dash": []interface{}{dash, space}}
+}
+
+// axisSettings maps the settings of a graph y axis to field settings
+func axisSettings(axis map[string]interface{}) map[string]interface{} {
+	s := make(map[string]interface{})
+	if unit := str(axis["format"]); unit != "" {
+		s["unit"] = unit
+	}
+	if label := str(axis["label"]); label != "" {
+		s["axisLabel"] = label
+	}
+	if show, ok := axis["show"].(bool); ok && !show {
+		s["axisPlacement"] = "hidden"
+	}
+	if min, ok := num(axis["min"]); ok {
+		s["min"] = min
+	}
+	if max, ok := num(axis["max"]); ok {
+		s["max"] = max
+	}
+	if base, ok := num(axis["logBase"]); ok && base > 1 {
+		s["scaleDistribution"] = map[string]interface{}{"type": "log", "log": base}
+	}
+	return s
+}
+
+// seriesOverrideProps maps a graph series override to field override
+// properties
+func seriesOverrideProps(so map[string]interface{}, yaxes []interface{}, m *MigrationResult) []map[string]interface{} {
+	var props []map[string]interface{}
+	drawStyle := false
+	for _, k := range sortedKeys(so) {
+		v := so[k]
+		switch k {
+		case "alias":
+		case "color":
+			props = append(props, property("color", fixedColor(str(v))))
+		case "yaxis":
+			if axis, _ := num(v); axis == 2 {
+				props = append(props, property("custom.axisPlacement", "right"))
+				if len(yaxes) > 1 {
+					right, _ := yaxes[1].(map[string]interface{})
+					for _, rk := range sortedKeys(axisSettings(right)) {
+						id := rk
+						if rk != "unit" && rk != "min" && rk != "max" {
+							id = "custom." + rk
+						}
+						props = append(props, property(id, axisSettings(right)[rk]))
+					}
+				}
+			}
+		case "lines", "bars", "points":
+			if !drawStyle {
+				props = append(props, property("custom.drawStyle", graphDrawStyle(so["lines"], so["bars"], so["points"])))
+				drawStyle = true
+			}
+			if k == "points" {
+				show := "never"
+				if boolOf(v) {
+					show = "always"
+				}
+				props = append(props, property("custom.showPoints", show))
+			}
+		case "linewidth":
+			props = append(props, property("custom.lineWidth", v))
+		case "fill":
+			if fill, ok := num(v); ok {
+				props = append(props, property("custom.fillOpacity", fill*10))
+			}
+		case "pointradius":
+			if r, ok := num(v); ok {
+				props = append(props, property("custom.pointSize", r*2))
+			}
+		case "stack":
+			mode := "none"
+			if boolOf(v) || str(v) == "A" || str(v) == "B" {
+				mode = "normal"
+			}
+			props = append(props, property("custom.stacking", map[string]interface{}{"mode": mode, "group": "A"}))
+		case "steppedLine":
+			interpolation := "linear"
+			if boolOf(v) {
+				interpolation = "stepAfter"
+			}
+			props = append(props, property("custom.lineInterpolation", interpolation))
+		case "dashes":
+			if boolOf(v) {
+				props = append(props, property("custom.lineStyle", dashStyle(so)))
+			}
+		case "dashLength", "spaceLength":
+		case "transform":
+			if str(v) == "negative-Y" {
+				props = append(props, property("custom.transform", "negative-Y"))
+			}
+		case "legend", "hideTooltip":
+			// both settings end up in the same property
+		default:
+			m.Dropped = append(m.Dropped, fmt.Sprintf("series override %s of %s", k, str(so["alias"])))
+		}
+	}
+	hideLegend := so["legend"] != nil && !boolOf(so["legend"])
+	hideTooltip := boolOf(so["hideTooltip"])
+	if hideLegend || hideTooltip {
+		props = append(props, property("custom.hideFrom", map[string]interface{}{"legend": hideLegend, "tooltip": hideTooltip, "viz": false}))
+	}
+	return props
+}
+
+// graphLegend maps the legend settings of a graph panel
+func graphLegend(legend map[string]interface{}) map[string]interface{} {
+	mode := "list"
+	if boolOf(legend["alignAsTable"]) {
+		mode = "table"
+	}
+	show := legend["show"] == nil || boolOf(legend["show"])
+	if !show {
+		mode = "hidden"
+	}
+	placement := "bottom"
+	if boolOf(legend["rightSide"]) {
+		placement = "right"
+	}
+	calcs := []interface{}{}
+	if boolOf(legend["values"]) {
+		for _, c := range []string{"min", "max", "avg", "current", "total"} {
+			if boolOf(legend[c]) {
+				calcs = append(calcs, reducers[c])
+			}
+		}
+	}
+	return map[string]interface{}{"displayMode": mode, "showLegend": show, "placement": placement, "calcs": calcs}
+}
+
+// graphThresholds maps the thresholds of a graph panel to threshold steps and
+// the style they are drawn in
+func graphThresholds(panel map[string]interface{}, m *MigrationResult) ([]interface{}, string) {
+	thresholds, _ := panel["thresholds"].([]interface{})
+	steps := []interface{}{map[string]interface{}{"color": "transparent", "value": nil}}
+	line, fill := false, false
+	for _, t := range thresholds {
+		th, _ := t.(map[string]interface{})
+		value, ok := num(th["value"])
+		if !ok {
+			continue
+		}
+		if str(th["op"]) == "lt" {
+			m.Dropped = append(m.Dropped, fmt.Sprintf("threshold below %v", value))
+			continue
+		}
+		color := thresholdColors[str(th["colorMode"])]
+		if color == "" {
+			color = str(th["lineColor"])
+		}
+		if color == "" {
+			color = str(th["fillColor"])
+		}
+		steps = append(steps, map[string]interface{}{"color": color, "value": value})
+		line = line || boolOf(th["line"])
+		fill = fill || boolOf(th["fill"])
+	}
+	if len(steps) == 1 {
+		return nil, ""
+	}
+	switch {
+	case line && fill:
+		return steps, "line+area"
+	case fill:
+		return steps, "area"
+	}
+	return steps, "line"
+}
+
+// migrateSinglestat maps the settings of a singlestat panel onto a stat or
+// gauge panel
+func migrateSinglestat(panel map[string]interface{}, m *MigrationResult) {
+	defaults, _ := fieldConfig(panel)
+	delete(defaults, "custom")
+	options := ensureObj(panel, "options")
+
+	valueName := str(panel["valueName"])
+	if valueName == "" {
+		valueName = "avg"
+	}
+	calc, ok := reducers[valueName]
+	switch {
+	case valueName == "name":
+		calc = "lastNotNull"
+		options["textMode"] = "name"
+	case !ok:
+		calc = "lastNotNull"
+		m.Dropped = append(m.Dropped, "value "+valueName)
+	}
+	options["reduceOptions"] = map[string]interface{}{"calcs": []interface{}{calc}, "fields": "", "values": false}
+	options["orientation"] = "auto"
+	options["justifyMode"] = "auto"
+	if _, ok := options["textMode"]; !ok {
+		options["textMode"] = "auto"
+	}
+
+	if unit := str(panel["format"]); unit != "" {
+		defaults["unit"] = unit
+	}
+	// the sdk writes the automatic decimals of singlestat panels as 0
+	if d, ok := num(panel["decimals"]); ok && d > 0 {
+		defaults["decimals"] = d
+	}
+	if text := str(panel["nullText"]); text != "" {
+		defaults["noValue"] = text
+	}
+	for _, k := range []string{"prefix", "postfix"} {
+		if s := str(panel[k]); s != "" {
+			m.Dropped = append(m.Dropped, fmt.Sprintf("%s %q", k, s))
+		}
+	}
+	if steps := singlestatThresholds(panel); len(steps) > 0 {
+		defaults["thresholds"] = map[string]interface{}{"mode": "absolute", "steps": steps}
+	}
+	if mappings := valueMappings(panel); len(mappings) > 0 {
+		defaults["mappings"] = mappings
+	}
+
+	gauge := obj(panel, "gauge")
+	if boolOf(gauge["show"]) {
+		options["showThresholdMarkers"] = boolOf(gauge["thresholdMarkers"])
+		options["showThresholdLabels"] = boolOf(gauge["thresholdLabels"])
+		if min, ok := num(gauge["minValue"]); ok {
+			defaults["min"] = min
+		}
+		if max, ok := num(gauge["maxValue"]); ok {
+			defaults["max"] = max
+		}
+		return
+	}
+	options["colorMode"] = "none"
+	switch {
+	case boolOf(panel["colorBackground"]):
+		options["colorMode"] = "background"
+	case boolOf(panel["colorValue"]):
+		options["colorMode"] = "value"
+	}
+	options["graphMode"] = "none"
+	if boolOf(obj(panel, "sparkline")["show"]) {
+		options["graphMode"] = "area"
+	}
+}
+
+// singlestatThresholds maps the comma separated thresholds and the colors of
+// a singlestat panel, or of a table-old column style, to threshold steps
+func singlestatThresholds(settings map[string]interface{}) []interface{} {
+	var values []interface{}
+	switch t := settings["thresholds"].(type) {
+	case string:
+		for _, v := range strings.Split(t, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	case []interface{}:
+		values = t
+	}
+	colors, _ := settings["colors"].([]interface{})
+	if len(values) == 0 || len(colors) == 0 {
+		return nil
+	}
+	steps := []interface{}{map[string]interface{}{"color": str(colors[0]), "value": nil}}
+	for i, v := range values {
+		value, ok := num(v)
+		if !ok || i+1 >= len(colors) {
+			break
+		}
+		steps = append(steps, map[string]interface{}{"color": str(colors[i+1]), "value": value})
+	}
+	return steps
+}
+
+// valueMappings maps the value or range maps of a singlestat panel, or of a
+// table-old column style, to value mappings
+func valueMappings(settings map[string]interface{}) []interface{} {
+	var mappings []interface{}
+	if t, _ := num(settings["mappingType"]); t == 2 {
+		ranges, _ := settings["rangeMaps"].([]interface{})
+		for _, r := range ranges {
+			rm, _ := r.(map[string]interface{})
+			result := map[string]interface{}{"text": str(rm["text"])}
+			from, fromOK := num(rm["from"])
+			to, toOK := num(rm["to"])
+			if str(rm["from"]) == "null" && str(rm["to"]) == "null" {
+				mappings = append(mappings, map[string]interface{}{"type": "special", "options": map[string]interface{}{"match": "null", "result": result}})
+				continue
+			}
+			if !fromOK && !toOK {
+				continue
+			}
+			opts := map[string]interface{}{"result": result}
+			if fromOK {
+				opts["from"] = from
+			}
+			if toOK {
+				opts["to"] = to
+			}
+			mappings = append(mappings, map[string]interface{}{"type": "range", "options": opts})
+		}
+		return mappings
+	}
+	values := map[string]interface{}{}
+	maps, _ := settings["valueMaps"].([]interface{})
+	for i, v := range maps {
+		vm, _ := v.(map[string]interface{})
+		value := str(vm["value"])
+		result := map[string]interface{}{"text": str(vm["text"]), "index": i}
+		if value == "null" {
+			mappings = append(mappings, map[string]interface{}{"type": "special", "options": map[string]interface{}{"match": "null", "result": result}})
+			continue
+		}
+		values[value] = result
+	}
+	if len(values) > 0 {
+		mappings = append(mappings, map[string]interface{}{"type": "value", "options": values})
+	}
+	return mappings
+}
+
+// migrateTableOld maps the settings of a table-old panel onto a table panel
+func migrateTableOld(panel map[string]interface{}, m *MigrationResult) {
+	defaults, custom := fieldConfig(panel)
+	options := ensureObj(panel, "options")
+	options["showHeader"] = panel["showHeader"] == nil || boolOf(panel["showHeader"])
+
+	targets, _ := panel["targets"].([]interface{})
+	var transformations []interface{}
+	switch str(panel["transform"]) {
+	case "timeseries_to_columns":
+		transformations = append(transformations, map[string]interface{}{"id": "seriesToColumns", "options": map[string]interface{}{}})
+	case "timeseries_to_rows":
+		transformations = append(transformations, map[string]interface{}{"id": "seriesToRows", "options": map[string]interface{}{}})
+	case "timeseries_aggregations":
+		calcs := []interface{}{}
+		columns, _ := panel["columns"].([]interface{})
+		for _, c := range columns {
+			col, _ := c.(map[string]interface{})
+			if r, ok := reducers[str(col["value"])]; ok {
+				calcs = append(calcs, r)
+			} else {
+				m.Dropped = append(m.Dropped, "column "+str(col["text"]))
+			}
+		}
+		if len(calcs) == 0 {
+			calcs = append(calcs, "mean")
+		}
+		transformations = append(transformations, map[string]interface{}{"id": "reduce", "options": map[string]interface{}{"reducers": calcs, "includeTimeField": false}})
+	default:
+		if len(targets) > 1 {
+			transformations = append(transformations, map[string]interface{}{"id": "merge", "options": map[string]interface{}{}})
+		}
+	}
+	if len(transformations) > 0 {
+		existing, _ := panel["transformations"].([]interface{})
+		panel["transformations"] = append(transformations, existing...)
+	}
+	if s := obj(panel, "sort"); s["col"] != nil {
+		m.Dropped = append(m.Dropped, "sort by column")
+	}
+
+	styles, _ := panel["styles"].([]interface{})
+	for _, s := range styles {
+		style, _ := s.(map[string]interface{})
+		pattern := str(style["pattern"])
+		props := columnStyleProps(style, m)
+		if pattern == "" || pattern == "/.*/" {
+			// the catch-all style becomes the defaults
+			for _, p := range props {
+				id := str(p["id"])
+				if strings.HasPrefix(id, "custom.") {
+					custom[strings.TrimPrefix(id, "custom.")] = p["value"]
+				} else {
+					defaults[id] = p["value"]
+				}
+			}
+			continue
+		}
+		addOverride(panel, pattern, props...)
+	}
+}
+
+// columnStyleProps maps a column style of a table-old panel to field override
+// properties
+func columnStyleProps(style map[string]interface{}, m *MigrationResult) []map[string]interface{} {
+	var props []map[string]interface{}
+	if alias := str(style["alias"]); alias != "" {
+		props = append(props, property("displayName", alias))
+	}
+	switch str(style["type"]) {
+	case "hidden":
+		return append(props, property("custom.hidden", true))
+	case "date":
+		unit := "dateTimeAsIso"
+		if f := str(style["dateFormat"]); f != "" && f != "YYYY-MM-DD HH:mm:ss" {
+			unit = "time: " + f
+		}
+		props = append(props, property("unit", unit))
+	case "number":
+		if unit := str(style["unit"]); unit != "" {
+			props = append(props, property("unit", unit))
+		}
+		if d, ok := num(style["decimals"]); ok {
+			props = append(props, property("decimals", d))
+		}
+	}
+	switch str(style["colorMode"]) {
+	case "cell":
+		props = append(props, property("custom.displayMode", "color-background"))
+	case "value":
+		props = append(props, property("custom.displayMode", "color-text"))
+	case "row":
+		props = append(props, property("custom.displayMode", "color-background"))
+		m.Dropped = append(m.Dropped, fmt.Sprintf("row coloring of %s", str(style["pattern"])))
+	}
+	if str(style["colorMode"]) != "" {
+		if steps := singlestatThresholds(style); len(steps) > 0 {
+			props = append(props, property("thresholds", map[string]interface{}{"mode": "absolute", "steps": steps}))
+		}
+	}
+	if mappings := valueMappings(style); len(mappings) > 0 {
+		props = append(props, property("mappings", mappings))
+	}
+	if boolOf(style["link"]) {
+		link := map[string]interface{}{"title": str(style["linkTooltip"]), "url": str(style["linkUrl"])}
+		if boolOf(style["linkTargetBlank"]) {
+			link["targetBlank"] = true
+		}
+		props = append(props, property("links", []interface{}{link}))
+	}
+	return props
+}
+
+// obj returns the object held by a key, or nil
+func obj(m map[string]interface{}, key string) map[string]interface{} {
+	o, _ := m[key].(map[string]interface{})
+	return o
+}
+
+// ensureObj returns the object held by a key, creating it as needed
+func ensureObj(m map[string]interface{}, key string) map[string]interface{} {
+	o, ok := m[key].(map[string]interface{})
+	if !ok {
+		o = make(map[string]interface{})
+		m[key] = o
+	}
+	return o
+}
+
+// str returns a JSON value as a string, numbers included
+func str(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return ""
+}
+
+// num returns a JSON value as a number, legacy panels save some numbers as
+// strings
+func num(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// boolOf returns a JSON value as a boolean
+func boolOf(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// sortedKeys returns the keys of an object in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
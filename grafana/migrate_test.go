@@ -0,0 +1,64 @@
+package grafana
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateGraph(t *testing.T) {
+	tests := []struct {
+		name       string
+		panel      string
+		showLegend bool
+		lineWidth  string
+		pointSize  string
+		fill       string
+		tooltip    string
+	}{
+		{
+			name:       "graph defaults",
+			panel:      `{"id":1,"type":"graph","targets":[{"refId":"A","target":"a.b.c"}]}`,
+			showLegend: true, lineWidth: "1", pointSize: "5", fill: "10", tooltip: "multi",
+		},
+		{
+			name: "panel settings",
+			panel: `{"id":1,"type":"graph","linewidth":3,"pointradius":1,"fill":0,
+				"legend":{"show":false},"tooltip":{"shared":false},"targets":[{"refId":"A","target":"a.b.c"}]}`,
+			showLegend: false, lineWidth: "3", pointSize: "2", fill: "0", tooltip: "single",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, err := DecodeBoard([]byte(`{"panels":[` + tt.panel + `]}`))
+			if err != nil {
+				t.Fatalf("DecodeBoard() error = %v", err)
+			}
+			res := &DashboardResult{}
+			if err := (Grafana{}).migratePanels(&board, res); err != nil {
+				t.Fatalf("migratePanels() error = %v", err)
+			}
+			if len(res.Migrations) != 1 || res.Migrations[0].To != "timeseries" {
+				t.Fatalf("migratePanels() migrations = %+v, want one to timeseries", res.Migrations)
+			}
+			raw, err := board.panelModel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			panel, _ := decodeModel(raw)
+			options := obj(panel, "options")
+			custom := obj(obj(obj(panel, "fieldConfig"), "defaults"), "custom")
+
+			if got := obj(options, "legend")["showLegend"]; got != tt.showLegend {
+				t.Errorf("legend.showLegend = %v, want %v", got, tt.showLegend)
+			}
+			if got := obj(options, "tooltip")["mode"]; got != tt.tooltip {
+				t.Errorf("tooltip.mode = %v, want %v", got, tt.tooltip)
+			}
+			for key, want := range map[string]string{"lineWidth": tt.lineWidth, "pointSize": tt.pointSize, "fillOpacity": tt.fill} {
+				if got := custom[key]; got != json.Number(want) {
+					t.Errorf("custom.%s = %v, want %s", key, got, want)
+				}
+			}
+		})
+	}
+}
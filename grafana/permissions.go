@@ -0,0 +1,237 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// Permission is an entry of a folder or dashboard permission list. Exactly
+// one of UserID, TeamID and Role is set.
+type Permission struct {
+	UserID     uint   `json:"userId,omitempty"`
+	UserLogin  string `json:"userLogin,omitempty"`
+	TeamID     uint   `json:"teamId,omitempty"`
+	Team       string `json:"team,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Permission int    `json:"permission"`
+	Inherited  bool   `json:"inherited,omitempty"`
+}
+
+// permissionItem is the form in which permissions are written back
+type permissionItem struct {
+	UserID     uint   `json:"userId,omitempty"`
+	TeamID     uint   `json:"teamId,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Permission int    `json:"permission"`
+}
+
+// FolderPermissions fetches the permissions set directly on a folder,
+// leaving out those inherited from parent folders
+func (g Grafana) FolderPermissions(ctx context.Context, folder Folder) ([]Permission, error) {
+	var perms []Permission
+	if err := g.apiRequest(ctx, http.MethodGet, "api/folders/"+url.PathEscape(folder.UID)+"/permissions", nil, &perms); err != nil {
+		return nil, fmt.Errorf("error fetching permissions of folder %s: %w", folder.Path, err)
+	}
+	return ownPermissions(perms), nil
+}
+
+// SetFolderPermissions replaces the permissions of a folder
+func (g Grafana) SetFolderPermissions(ctx context.Context, folder Folder, perms []Permission) error {
+	if g.DryRun {
+		logger.Printf(logger.LvlInfo, "Dry run, not setting %d permission(s) on folder %s", len(perms), folder.Path)
+		return nil
+	}
+	entry := JournalEntry{Kind: JournalFolderPermissions, DestUID: folder.UID, Title: folder.Path}
+	if g.Journal != nil {
+		prev, err := g.FolderPermissions(ctx, folder)
+		if err != nil {
+			return err
+		}
+		if entry.Previous, err = json.Marshal(prev); err != nil {
+			return err
+		}
+	}
+	body := map[string][]permissionItem{"items": permissionItems(perms)}
+	if err := g.apiRequest(ctx, http.MethodPost, "api/folders/"+url.PathEscape(folder.UID)+"/permissions", body, nil); err != nil {
+		return fmt.Errorf("error setting permissions of folder %s: %w", folder.Path, err)
+	}
+	logger.Printf(logger.LvlInfo, "Set %d permission(s) on folder %s", len(perms), folder.Path)
+	return g.record(entry)
+}
+
+// copyFolderPermissions copies the permissions of src onto dst. The General
+// folder has no permissions of its own to copy.
+func (g Grafana) copyFolderPermissions(ctx context.Context, src, dst Folder) error {
+	if src.IsGeneral() {
+		logger.Printf(logger.LvlWarning, "The General folder has no permissions to copy onto %s", dst.Path)
+		return nil
+	}
+	perms, err := g.FolderPermissions(ctx, src)
+	if err != nil {
+		return err
+	}
+	return g.SetFolderPermissions(ctx, dst, perms)
+}
+
+// ownPermissions leaves out inherited permissions
+func ownPermissions(perms []Permission) []Permission {
+	var own []Permission
+	for _, p := range perms {
+		if !p.Inherited {
+			own = append(own, p)
+		}
+	}
+	return own
+}
+
+// permissionItems converts permissions into the form the API accepts
+func permissionItems(perms []Permission) []permissionItem {
+	items := make([]permissionItem, 0, len(perms))
+	for _, p := range perms {
+		items = append(items, permissionItem{UserID: p.UserID, TeamID: p.TeamID, Role: p.Role, Permission: p.Permission})
+	}
+	return items
+}
+
+// PermissionResult records how the permissions of a source dashboard were
+// carried over to its converted copy
+type PermissionResult struct {
+	Copied []string `json:"copied,omitempty"`
+	// Unmapped lists permissions that have no equivalent on the copy
+	Unmapped []string `json:"unmapped,omitempty"`
+	// Extra lists principals the destination folder grants access to that
+	// had no access to the source dashboard
+	Extra []string `json:"extra,omitempty"`
+}
+
+// DashboardPermissions fetches the permissions of a dashboard, including
+// those inherited from its folder
+func (g Grafana) DashboardPermissions(ctx context.Context, uid string) ([]Permission, error) {
+	var perms []Permission
+	if err := g.apiRequest(ctx, http.MethodGet, "api/dashboards/uid/"+url.PathEscape(uid)+"/permissions", nil, &perms); err != nil {
+		return nil, fmt.Errorf("error fetching permissions of dashboard %s: %w", uid, err)
+	}
+	return perms, nil
+}
+
+// SetDashboardPermissions replaces the permissions set directly on a dashboard
+func (g Grafana) SetDashboardPermissions(ctx context.Context, uid, title string, perms []Permission) error {
+	entry := JournalEntry{Kind: JournalDashboardPermissions, DestUID: uid, Title: title}
+	if g.Journal != nil {
+		prev, err := g.DashboardPermissions(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if entry.Previous, err = json.Marshal(ownPermissions(prev)); err != nil {
+			return err
+		}
+	}
+	body := map[string][]permissionItem{"items": permissionItems(perms)}
+	if err := g.apiRequest(ctx, http.MethodPost, "api/dashboards/uid/"+url.PathEscape(uid)+"/permissions", body, nil); err != nil {
+		return fmt.Errorf("error setting permissions of dashboard %s: %w", uid, err)
+	}
+	return g.record(entry)
+}
+
+// mapDashboardPermissions works out the permissions to set on the copy of a
+// source dashboard so that the same principals keep the same access. The
+// permissions the source inherits from its folder become explicit ones as
+// the copy lives in another folder.
+func (g Grafana) mapDashboardPermissions(ctx context.Context, srcUID string, dstFolder Folder) ([]Permission, *PermissionResult, error) {
+	src, err := g.DashboardPermissions(ctx, srcUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := &PermissionResult{}
+	var perms []Permission
+	index := make(map[string]int)
+	for _, p := range src {
+		key := principal(p)
+		switch {
+		case p.Role == "Admin":
+			// admins always have full access
+			continue
+		case key == "" || (p.Role != "" && p.Role != "Viewer" && p.Role != "Editor"):
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf("%s with permission %d", describePermission(p), p.Permission))
+			continue
+		}
+		// a principal can be listed both on the dashboard and its folder
+		if i, ok := index[key]; ok {
+			if p.Permission > perms[i].Permission {
+				perms[i].Permission = p.Permission
+			}
+			continue
+		}
+		index[key] = len(perms)
+		perms = append(perms, Permission{UserID: p.UserID, UserLogin: p.UserLogin, TeamID: p.TeamID, Team: p.Team, Role: p.Role, Permission: p.Permission})
+	}
+	for _, p := range perms {
+		res.Copied = append(res.Copied, fmt.Sprintf("%s: %s", describePermission(p), permissionName(p.Permission)))
+	}
+
+	// the copy also inherits whatever its folder grants
+	if !dstFolder.IsGeneral() && dstFolder.UID != "" {
+		folderPerms, err := g.FolderPermissions(ctx, dstFolder)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, fp := range folderPerms {
+			if fp.Role == "Admin" {
+				continue
+			}
+			i, ok := index[principal(fp)]
+			if !ok || perms[i].Permission < fp.Permission {
+				res.Extra = append(res.Extra, fmt.Sprintf("%s: %s", describePermission(fp), permissionName(fp.Permission)))
+			}
+		}
+	}
+	return perms, res, nil
+}
+
+// principal returns a key identifying who a permission is for
+func principal(p Permission) string {
+	switch {
+	case p.UserID != 0:
+		return fmt.Sprintf("user:%d", p.UserID)
+	case p.TeamID != 0:
+		return fmt.Sprintf("team:%d", p.TeamID)
+	case p.Role != "":
+		return "role:" + p.Role
+	}
+	return ""
+}
+
+// describePermission names the principal of a permission for reports
+func describePermission(p Permission) string {
+	switch {
+	case p.UserID != 0 && p.UserLogin != "":
+		return "user " + p.UserLogin
+	case p.UserID != 0:
+		return fmt.Sprintf("user %d", p.UserID)
+	case p.TeamID != 0 && p.Team != "":
+		return "team " + p.Team
+	case p.TeamID != 0:
+		return fmt.Sprintf("team %d", p.TeamID)
+	case p.Role != "":
+		return "role " + p.Role
+	}
+	return "unknown principal"
+}
+
+// permissionName returns the name of a Grafana permission level
+func permissionName(level int) string {
+	switch level {
+	case 1:
+		return "View"
+	case 2:
+		return "Edit"
+	case 4:
+		return "Admin"
+	}
+	return fmt.Sprintf("level %d", level)
+}
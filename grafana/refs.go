@@ -0,0 +1,64 @@
+package grafana
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bdunavant/sdk"
+)
+
+// targetRefRe matches graphite references to sibling targets such as #A
+var targetRefRe = regexp.MustCompile(`#([A-Za-z]+)\b`)
+
+// graphiteQuery returns the graphite query of a target, preferring the
+// already expanded TargetFull when Grafana populated it
+func graphiteQuery(target sdk.Target) string {
+	if target.TargetFull != "" {
+		return target.TargetFull
+	}
+	return target.Target
+}
+
+// expandTargetRefs replaces the #refId references in the query of target refID
+// with the queries of the sibling targets they point at, recursively. Anything
+// that looks like a reference but names no sibling is left untouched.
+func expandTargetRefs(refID, query string, siblings map[string]string) (string, error) {
+	return expandRefs(query, siblings, map[string]bool{refID: true})
+}
+
+func expandRefs(query string, siblings map[string]string, visiting map[string]bool) (string, error) {
+	var err error
+	expanded := targetRefRe.ReplaceAllStringFunc(query, func(m string) string {
+		ref := m[1:]
+		sibling, ok := siblings[ref]
+		if err != nil || !ok {
+			return m
+		}
+		if visiting[ref] {
+			err = fmt.Errorf("circular reference to #%s", ref)
+			return m
+		}
+		visiting[ref] = true
+		sub, subErr := expandRefs(sibling, siblings, visiting)
+		delete(visiting, ref)
+		if subErr != nil {
+			err = subErr
+			return m
+		}
+		return sub
+	})
+	return expanded, err
+}
+
+// referencedTargets returns the refIds that other targets refer to
+func referencedTargets(siblings map[string]string) map[string]bool {
+	referenced := make(map[string]bool)
+	for refID, query := range siblings {
+		for _, m := range targetRefRe.FindAllStringSubmatch(query, -1) {
+			if _, ok := siblings[m[1]]; ok && m[1] != refID {
+				referenced[m[1]] = true
+			}
+		}
+	}
+	return referenced
+}
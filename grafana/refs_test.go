@@ -0,0 +1,105 @@
+package grafana
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandTargetRefs(t *testing.T) {
+	tests := []struct {
+		name     string
+		refID    string
+		siblings map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "no reference",
+			refID:    "A",
+			siblings: map[string]string{"A": "a.b.c"},
+			want:     "a.b.c",
+		},
+		{
+			name:     "single reference",
+			refID:    "B",
+			siblings: map[string]string{"A": "a.b.c", "B": "scale(#A, 10)"},
+			want:     "scale(a.b.c, 10)",
+		},
+		{
+			name:     "several references",
+			refID:    "C",
+			siblings: map[string]string{"A": "a.b", "B": "c.d", "C": "divideSeries(#A, #B)"},
+			want:     "divideSeries(a.b, c.d)",
+		},
+		{
+			name:     "nested references",
+			refID:    "C",
+			siblings: map[string]string{"A": "a.b.c", "B": "sumSeries(#A)", "C": "alias(#B, 'total')"},
+			want:     "alias(sumSeries(a.b.c), 'total')",
+		},
+		{
+			// hidden helpers stay among the siblings, only their display is off
+			name:     "reference to a hidden helper",
+			refID:    "B",
+			siblings: map[string]string{"A": "servers.*.cpu", "B": "asPercent(#A, sumSeries(#A))"},
+			want:     "asPercent(servers.*.cpu, sumSeries(servers.*.cpu))",
+		},
+		{
+			name:     "reference to no sibling",
+			refID:    "A",
+			siblings: map[string]string{"A": "scale(#Z, 2)"},
+			want:     "scale(#Z, 2)",
+		},
+		{
+			name:     "self reference",
+			refID:    "A",
+			siblings: map[string]string{"A": "sumSeries(#A)"},
+			wantErr:  true,
+		},
+		{
+			name:     "mutual references",
+			refID:    "A",
+			siblings: map[string]string{"A": "sumSeries(#B)", "B": "scale(#A, 2)"},
+			wantErr:  true,
+		},
+		{
+			name:     "cycle below the target",
+			refID:    "C",
+			siblings: map[string]string{"A": "sumSeries(#B)", "B": "scale(#A, 2)", "C": "alias(#A, 'x')"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTargetRefs(tt.refID, tt.siblings[tt.refID], tt.siblings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandTargetRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expandTargetRefs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferencedTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		siblings map[string]string
+		want     map[string]bool
+	}{
+		{"no reference", map[string]string{"A": "a.b", "B": "c.d"}, map[string]bool{}},
+		{"reference", map[string]string{"A": "a.b", "B": "scale(#A, 2)"}, map[string]bool{"A": true}},
+		{"nested references", map[string]string{"A": "a.b", "B": "sumSeries(#A)", "C": "alias(#B, 'x')"}, map[string]bool{"A": true, "B": true}},
+		{"self reference", map[string]string{"A": "sumSeries(#A)"}, map[string]bool{}},
+		{"mutual references", map[string]string{"A": "sumSeries(#B)", "B": "scale(#A, 2)"}, map[string]bool{"A": true, "B": true}},
+		{"reference to no sibling", map[string]string{"A": "scale(#Z, 2)"}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := referencedTargets(tt.siblings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("referencedTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteReportJSON writes the conversion results as an indented JSON document
+func WriteReportJSON(w io.Writer, results []*DashboardResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(results)
+}
+
+// WriteReportMarkdown writes the conversion results as a Markdown document
+// suitable for handing to dashboard owners
+func WriteReportMarkdown(w io.Writer, results []*DashboardResult) error {
+	var b strings.Builder
+	b.WriteString("# Conversion report\n")
+	for _, res := range results {
+		fmt.Fprintf(&b, "\n## %s (`%s`)\n\n", mdEscape(res.Title), res.UID)
+		fmt.Fprintf(&b, "- New title: %s\n", mdEscape(res.NewTitle))
+		if res.PreviousVersion != 0 {
+			fmt.Fprintf(&b, "- Previous version: %d\n", res.PreviousVersion)
+		}
+		if res.Folder != "" {
+			fmt.Fprintf(&b, "- Folder: %s\n", mdEscape(res.Folder))
+		}
+		fmt.Fprintf(&b, "- Panels changed: %d, targets changed: %d, variables changed: %d, annotations changed: %d, links rewritten: %d\n",
+			res.PanelsChanged, res.TargetsChanged, res.VariablesChanged, res.AnnotationsChanged, res.LinksRewritten)
+		if len(res.Failures) > 0 {
+			b.WriteString("\n### Failures\n\n")
+			for _, f := range res.Failures {
+				fmt.Fprintf(&b, "- %s\n", mdEscape(f))
+			}
+		}
+		if len(res.Skipped) > 0 {
+			b.WriteString("\n### Not converted\n\n")
+			for _, s := range res.Skipped {
+				fmt.Fprintf(&b, "- %s\n", mdEscape(s))
+			}
+		}
+		if len(res.Variables) > 0 {
+			b.WriteString("\n### Variables\n\n")
+			for _, v := range res.Variables {
+				if v.Unsupported != "" {
+					fmt.Fprintf(&b, "- %s: not converted, %s\n", mdEscape(v.Name), mdEscape(v.Unsupported))
+					continue
+				}
+				fmt.Fprintf(&b, "- %s: %s\n", mdEscape(v.Name), mdCode(v.Query))
+				for _, n := range v.Notes {
+					fmt.Fprintf(&b, "  - %s\n", mdEscape(n))
+				}
+			}
+		}
+		if len(res.Annotations) > 0 {
+			b.WriteString("\n### Annotations\n\n")
+			for _, a := range res.Annotations {
+				switch {
+				case a.Unsupported != "":
+					fmt.Fprintf(&b, "- %s: not converted, %s\n", mdEscape(a.Name), mdEscape(a.Unsupported))
+				case a.Error != "":
+					fmt.Fprintf(&b, "- %s: %s failed: %s\n", mdEscape(a.Name), mdCode(a.Original), mdEscape(a.Error))
+				default:
+					fmt.Fprintf(&b, "- %s: %s → %s\n", mdEscape(a.Name), mdCode(a.Original), mdCode(a.CAQL))
+				}
+			}
+		}
+		if len(res.LibraryPanels) > 0 {
+			b.WriteString("\n### Library panels\n\n")
+			for _, l := range res.LibraryPanels {
+				switch {
+				case l.Unsupported != "":
+					fmt.Fprintf(&b, "- %s: not converted, %s\n", mdEscape(l.Name), mdEscape(l.Unsupported))
+				case l.NewUID == "" && len(l.Failures) == 0:
+					fmt.Fprintf(&b, "- %s: nothing to convert\n", mdEscape(l.Name))
+				case l.NewUID == "":
+					fmt.Fprintf(&b, "- %s: not converted\n", mdEscape(l.Name))
+				case l.NewUID == l.UID:
+					fmt.Fprintf(&b, "- %s: converted in place, targets changed: %d\n", mdEscape(l.Name), l.TargetsChanged)
+				default:
+					fmt.Fprintf(&b, "- %s: converted into %s (`%s`), targets changed: %d\n", mdEscape(l.Name), mdEscape(l.NewName), l.NewUID, l.TargetsChanged)
+				}
+				for _, f := range l.Failures {
+					fmt.Fprintf(&b, "  - %s\n", mdEscape(f))
+				}
+				if l.Panel != nil {
+					for _, n := range l.Panel.SeriesNames {
+						writeSeriesName(&b, "  ", l.Panel, n)
+					}
+				}
+				if l.Migration != nil {
+					writeMigration(&b, "  ", l.Migration)
+				}
+			}
+		}
+		var renamed bool
+		for _, p := range res.Panels {
+			for _, n := range p.SeriesNames {
+				if !renamed {
+					b.WriteString("\n### Series names\n\n")
+					renamed = true
+				}
+				writeSeriesName(&b, "", p, n)
+			}
+		}
+		if len(res.Migrations) > 0 {
+			b.WriteString("\n### Panel migrations\n\n")
+			for _, m := range res.Migrations {
+				writeMigration(&b, "", m)
+			}
+		}
+		if res.Permissions != nil {
+			b.WriteString("\n### Permissions\n\n")
+			for _, c := range res.Permissions.Copied {
+				fmt.Fprintf(&b, "- Copied %s\n", mdEscape(c))
+			}
+			for _, u := range res.Permissions.Unmapped {
+				fmt.Fprintf(&b, "- Not copied: %s\n", mdEscape(u))
+			}
+			for _, e := range res.Permissions.Extra {
+				fmt.Fprintf(&b, "- Also granted by the destination folder: %s\n", mdEscape(e))
+			}
+		}
+		for _, p := range res.Panels {
+			if p.Alert == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "\n### Alert %q on panel %d %s (%s)\n\n", p.Alert.Name, p.ID, mdEscape(p.Title), p.Alert.Mode)
+			for _, rs := range p.Alert.Rulesets {
+				fmt.Fprintf(&b, "- Ruleset on %s with %d rule(s)\n", mdCode(rs.MetricName), len(rs.Rules))
+			}
+			for _, f := range p.Alert.Files {
+				fmt.Fprintf(&b, "- Written to `%s`\n", f)
+			}
+			for _, u := range p.Alert.Unsupported {
+				fmt.Fprintf(&b, "- Cannot be expressed: %s\n", mdEscape(u))
+			}
+			if p.Alert.Kept {
+				b.WriteString("- Kept in Grafana, not every condition became a ruleset\n")
+			}
+		}
+		if len(res.Panels) == 0 {
+			continue
+		}
+		b.WriteString("\n| Panel | RefID | Graphite | CAQL | Error | Statsd rewrites |\n")
+		b.WriteString("|---|---|---|---|---|---|\n")
+		for _, p := range res.Panels {
+			for _, t := range p.Targets {
+				var rewrites []string
+				for _, r := range t.StatsdRewrites {
+					rewrites = append(rewrites, fmt.Sprintf("`%s` → `%s`", r.From, r.To))
+				}
+				fmt.Fprintf(&b, "| %d %s | %s | %s | %s | %s | %s |\n",
+					p.ID, mdEscape(p.Title), t.RefID, mdCode(t.Original), mdCode(t.CAQL),
+					mdEscape(t.Error), strings.Join(rewrites, "<br>"))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteReportFile writes the conversion results to path using the given
+// writer function
+func WriteReportFile(path string, results []*DashboardResult, write func(io.Writer, []*DashboardResult) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report %s: %w", path, err)
+	}
+	if err := write(f, results); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing report %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// mdEscape escapes characters that would break a Markdown table cell
+func mdEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// mdCode formats s as inline code, or nothing if s is empty
+func mdCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(mdEscape(s), "`", "'") + "`"
+}
+
+// writeMigration writes the migration of a panel as a list item
+func writeMigration(b *strings.Builder, indent string, m *MigrationResult) {
+	if m.Skipped != "" {
+		fmt.Fprintf(b, "%s- Panel %d %s: left as %s, %s\n", indent, m.ID, mdEscape(m.Title), m.From, mdEscape(m.Skipped))
+		return
+	}
+	fmt.Fprintf(b, "%s- Panel %d %s: %s → %s\n", indent, m.ID, mdEscape(m.Title), m.From, m.To)
+	for _, d := range m.Dropped {
+		fmt.Fprintf(b, "%s  - Dropped %s\n", indent, mdEscape(d))
+	}
+}
+
+// writeSeriesName writes an override keyed on a series name as a list item
+func writeSeriesName(b *strings.Builder, indent string, p *PanelResult, n *SeriesNameResult) {
+	if n.Unmatched != "" {
+		fmt.Fprintf(b, "%s- Panel %d %s: %s %s no longer matches, %s\n", indent, p.ID, mdEscape(p.Title), n.Kind, mdCode(n.From), mdEscape(n.Unmatched))
+		return
+	}
+	fmt.Fprintf(b, "%s- Panel %d %s: %s %s → %s\n", indent, p.ID, mdEscape(p.Title), n.Kind, mdCode(n.From), mdCode(n.To))
+}
@@ -0,0 +1,86 @@
+package grafana
+
+import (
+	"fmt"
+
+	"github.com/circonus/grafana-ds-convert/circonus"
+)
+
+// DashboardResult records what converting a dashboard changed, or in dry-run
+// mode what it would change. Written tells whether the converted dashboard
+// was written, or in dry-run mode would be.
+type DashboardResult struct {
+	UID                string                `json:"uid"`
+	Title              string                `json:"title"`
+	NewTitle           string                `json:"new_title"`
+	NewUID             string                `json:"new_uid,omitempty"`
+	Written            bool                  `json:"written"`
+	PreviousVersion    uint                  `json:"previous_version,omitempty"`
+	Folder             string                `json:"folder"`
+	PanelsChanged      int                   `json:"panels_changed"`
+	TargetsChanged     int                   `json:"targets_changed"`
+	VariablesChanged   int                   `json:"variables_changed"`
+	AnnotationsChanged int                   `json:"annotations_changed"`
+	LinksRewritten     int                   `json:"links_rewritten"`
+	Failures           []string              `json:"failures,omitempty"`
+	Skipped            []string              `json:"skipped,omitempty"`
+	Panels             []*PanelResult        `json:"panels,omitempty"`
+	Variables          []*VariableResult     `json:"variables,omitempty"`
+	Annotations        []*AnnotationResult   `json:"annotations,omitempty"`
+	LibraryPanels      []*LibraryPanelResult `json:"library_panels,omitempty"`
+	Migrations         []*MigrationResult    `json:"migrations,omitempty"`
+	Permissions        *PermissionResult     `json:"permissions,omitempty"`
+}
+
+// PanelResult records the translation of every target of a panel
+type PanelResult struct {
+	ID      uint            `json:"id"`
+	Title   string          `json:"title"`
+	Targets []*TargetResult `json:"targets"`
+	Alert   *AlertResult    `json:"alert,omitempty"`
+	// SeriesNames records the overrides keyed on the names of the series
+	// of the panel
+	SeriesNames []*SeriesNameResult `json:"series_names,omitempty"`
+}
+
+// TargetResult records the translation of a single panel target
+type TargetResult struct {
+	RefID          string                   `json:"ref_id"`
+	Original       string                   `json:"original"`
+	Expanded       string                   `json:"expanded,omitempty"`
+	CAQL           string                   `json:"caql,omitempty"`
+	Error          string                   `json:"error,omitempty"`
+	StatsdRewrites []circonus.StatsdRewrite `json:"statsd_rewrites,omitempty"`
+	// Series is the name graphite gives the series of the target and Label
+	// the one the translation gives them, when known
+	Series string `json:"series,omitempty"`
+	Label  string `json:"label,omitempty"`
+}
+
+// addFailure records a failure against the dashboard
+func (r *DashboardResult) addFailure(format string, v ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, v...))
+}
+
+// addSkipped records something left alone against the dashboard because
+// its datasource is not known to be graphite
+func (r *DashboardResult) addSkipped(format string, v ...interface{}) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, v...))
+}
+
+// target returns the result for the target with the given refId
+func (p *PanelResult) target(refID string) *TargetResult {
+	for _, t := range p.Targets {
+		if t.RefID == refID {
+			return t
+		}
+	}
+	return nil
+}
+
+// addPanel starts recording the translations of a panel
+func (r *DashboardResult) addPanel(id uint, title string) *PanelResult {
+	p := &PanelResult{ID: id, Title: title}
+	r.Panels = append(r.Panels, p)
+	return p
+}
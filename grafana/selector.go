@@ -0,0 +1,124 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+)
+
+// searchPageSize is the number of results requested per search page
+const searchPageSize = 1000
+
+// Selector narrows down the dashboards converted from a folder, or selects
+// dashboards across all folders when no source folder is given. Every set
+// criterion must match.
+type Selector struct {
+	// Tags must all be present on a dashboard
+	Tags []string
+	// ExcludeTags rejects dashboards having any of them
+	ExcludeTags []string
+	// Title must match the dashboard title
+	Title *regexp.Regexp
+	// ExcludeTitle rejects dashboards whose title matches
+	ExcludeTitle *regexp.Regexp
+	// UIDs lists the dashboards to convert
+	UIDs []string
+	// Query is a Grafana search query matched against dashboard titles
+	Query string
+}
+
+// IsSet reports whether any criterion is set
+func (s Selector) IsSet() bool {
+	return len(s.Tags) > 0 || len(s.ExcludeTags) > 0 || s.Title != nil ||
+		s.ExcludeTitle != nil || len(s.UIDs) > 0 || s.Query != ""
+}
+
+// Match reports whether a dashboard found by a search is selected
+func (s Selector) Match(b sdk.FoundBoard) bool {
+	for _, tag := range s.Tags {
+		if !contains(b.Tags, tag) {
+			return false
+		}
+	}
+	for _, tag := range s.ExcludeTags {
+		if contains(b.Tags, tag) {
+			return false
+		}
+	}
+	if s.Title != nil && !s.Title.MatchString(b.Title) {
+		return false
+	}
+	if s.ExcludeTitle != nil && s.ExcludeTitle.MatchString(b.Title) {
+		return false
+	}
+	if len(s.UIDs) > 0 && !contains(s.UIDs, b.UID) {
+		return false
+	}
+	return true
+}
+
+// MatchLocal reports whether a dashboard read from a local file is selected.
+// Without Grafana to search, the query is matched as a case insensitive
+// part of the title.
+func (s Selector) MatchLocal(b sdk.FoundBoard) bool {
+	if s.Query != "" && !strings.Contains(strings.ToLower(b.Title), strings.ToLower(s.Query)) {
+		return false
+	}
+	return s.Match(b)
+}
+
+// searchBoards finds the selected dashboards, directly inside folder if it
+// is not nil or else in any folder but exclude. The query and tags are left
+// to Grafana, the other criteria are applied to the search results.
+func (g Grafana) searchBoards(ctx context.Context, folder *Folder, exclude Folder) ([]sdk.FoundBoard, error) {
+	params := []sdk.SearchParam{sdk.SearchType(sdk.SearchTypeDashboard), sdk.SearchQuery(g.Selector.Query), sdk.SearchLimit(searchPageSize)}
+	for _, tag := range g.Selector.Tags {
+		params = append(params, sdk.SearchTag(tag))
+	}
+	if folder != nil {
+		params = append(params, sdk.SearchFolderID(int(folder.ID)))
+	}
+	var selected []sdk.FoundBoard
+	seen := make(map[string]bool)
+	for page := uint(1); ; page++ {
+		found, err := g.Client.Search(ctx, append(params, sdk.SearchPage(page))...)
+		if err != nil {
+			return nil, fmt.Errorf("error searching dashboards: %w", err)
+		}
+		fresh := 0
+		for _, b := range found {
+			if seen[b.UID] {
+				continue
+			}
+			seen[b.UID] = true
+			fresh++
+			// never pick up converted dashboards as sources
+			if g.UIDMap.IsConverted(b.UID) || (folder == nil && inFolder(b, exclude)) {
+				continue
+			}
+			if g.Selector.Match(b) {
+				selected = append(selected, b)
+			}
+		}
+		// versions without paging return the first page again
+		if len(found) < searchPageSize || fresh == 0 {
+			return selected, nil
+		}
+	}
+}
+
+// inFolder reports whether a dashboard found by a search is directly inside
+// folder, using the folder ID where Grafana does not return folder UIDs
+func inFolder(b sdk.FoundBoard, folder Folder) bool {
+	// folders not created in dry-run mode are empty
+	if folder.UID == "" && !folder.IsGeneral() {
+		return false
+	}
+	if b.FolderUID != "" {
+		return b.FolderUID == folder.UID
+	}
+	return b.FolderID == int(folder.ID)
+}
@@ -0,0 +1,48 @@
+package grafana
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/bdunavant/sdk"
+)
+
+func TestSelectorMatch(t *testing.T) {
+	board := sdk.FoundBoard{UID: "abc", Title: "Web Servers", Tags: []string{"prod", "web"}}
+	tests := []struct {
+		name      string
+		selector  Selector
+		want      bool
+		wantLocal bool
+	}{
+		{"nothing set", Selector{}, true, true},
+		{"all tags present", Selector{Tags: []string{"prod", "web"}}, true, true},
+		{"a tag missing", Selector{Tags: []string{"prod", "db"}}, false, false},
+		{"excluded tag present", Selector{ExcludeTags: []string{"db", "web"}}, false, false},
+		{"excluded tag absent", Selector{ExcludeTags: []string{"db"}}, true, true},
+		{"title matches", Selector{Title: regexp.MustCompile(`^Web`)}, true, true},
+		{"title does not match", Selector{Title: regexp.MustCompile(`^DB`)}, false, false},
+		{"excluded title matches", Selector{ExcludeTitle: regexp.MustCompile(`Servers$`)}, false, false},
+		{"excluded title does not match", Selector{ExcludeTitle: regexp.MustCompile(`Old`)}, true, true},
+		{"uid listed", Selector{UIDs: []string{"xyz", "abc"}}, true, true},
+		{"uid not listed", Selector{UIDs: []string{"xyz"}}, false, false},
+		// the query is left to Grafana for searches, matched locally otherwise
+		{"query in title", Selector{Query: "web serv"}, true, true},
+		{"query not in title", Selector{Query: "database"}, true, false},
+		{
+			"every criterion must match",
+			Selector{Tags: []string{"prod"}, Title: regexp.MustCompile(`Web`), UIDs: []string{"xyz"}},
+			false, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.Match(board); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+			if got := tt.selector.MatchLocal(board); got != tt.wantLocal {
+				t.Errorf("MatchLocal() = %v, want %v", got, tt.wantLocal)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bdunavant/sdk"
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// Output sink kinds selectable through configuration
+const (
+	OutputGrafana = "grafana"
+	OutputStdout  = "stdout"
+	OutputDir     = "dir"
+)
+
+// Sink receives converted dashboards
+type Sink interface {
+	// Write stores a converted dashboard, name is a file safe identifier
+	// of the source dashboard and folder is the resolved destination folder
+	Write(name string, board Dashboard, folder sdk.FoundBoard) error
+}
+
+// NewSink creates the sink for the given output kind, g is used to reach
+// Grafana when writing to it
+func NewSink(kind, dir string, g Grafana) (Sink, error) {
+	switch kind {
+	case OutputGrafana:
+		return GrafanaSink{Grafana: g}, nil
+	case OutputStdout:
+		return WriterSink{Writer: os.Stdout}, nil
+	case OutputDir:
+		if dir == "" {
+			return nil, fmt.Errorf("output %q requires an output directory", kind)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating output directory: %w", err)
+		}
+		return DirSink{Dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown output %q", kind)
+}
+
+// GrafanaSink pushes converted dashboards to Grafana
+type GrafanaSink struct {
+	Grafana Grafana
+}
+
+// Write creates or overwrites the dashboard in the destination folder. In
+// place conversions are saved without overwriting, so that Grafana rejects
+// them if the dashboard was changed since it was fetched.
+func (s GrafanaSink) Write(name string, board Dashboard, folder sdk.FoundBoard) error {
+	body := struct {
+		Dashboard Dashboard `json:"dashboard"`
+		FolderID  uint      `json:"folderId"`
+		Message   string    `json:"message,omitempty"`
+		Overwrite bool      `json:"overwrite"`
+	}{board, folder.ID, s.Grafana.CommitMessage, !s.Grafana.InPlace}
+	var sm sdk.StatusMessage
+	if err := s.Grafana.apiRequest(context.Background(), http.MethodPost, "api/dashboards/db", body, &sm); err != nil {
+		return err
+	}
+	if s.Grafana.Debug {
+		logger.PrintMarshal(logger.LvlDebug, "Create Dashboard Response:", sm)
+	}
+	return nil
+}
+
+// WriterSink writes converted dashboards as indented JSON documents
+type WriterSink struct {
+	Writer io.Writer
+}
+
+// Write encodes the dashboard to the writer
+func (s WriterSink) Write(name string, board Dashboard, folder sdk.FoundBoard) error {
+	enc := json.NewEncoder(s.Writer)
+	enc.SetIndent("", "    ")
+	return enc.Encode(board)
+}
+
+// DirSink writes each converted dashboard to <Dir>/<name>.json, named after
+// the file or the UID of the source dashboard
+type DirSink struct {
+	Dir string
+}
+
+// Write stores the dashboard in its own file
+func (s DirSink) Write(name string, board Dashboard, folder sdk.FoundBoard) error {
+	data, err := json.MarshalIndent(board, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling dashboard: %w", err)
+	}
+	path := filepath.Join(s.Dir, name+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	logger.Printf(logger.LvlInfo, "Wrote dashboard %s to %s", board.Title, path)
+	return nil
+}
+
+// boardName returns a file safe name for a dashboard: the name of the file
+// it was read from, its UID if it has one or else a slug of its title
+func boardName(board Dashboard) string {
+	if board.File != "" {
+		base := filepath.Base(board.File)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if board.UID != "" {
+		return filepath.Base(board.UID)
+	}
+	return board.UpdateSlug()
+}
+
+// namedOutput reports whether converted dashboards are written under their
+// boardName, either to the sink or as rulesets
+func (g Grafana) namedOutput() bool {
+	_, stream := g.Sink.(WriterSink)
+	return !stream || g.Alerts == AlertsRuleset
+}
@@ -0,0 +1,125 @@
+package grafana
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bdunavant/sdk"
+)
+
+// DefaultTitleTemplate names converted copies after their source dashboard
+const DefaultTitleTemplate = "{{.Title}} Circonus"
+
+// stampPrefix starts the description line added by the source stamp, it is
+// replaced rather than repeated when a dashboard is stamped again
+const stampPrefix = "Converted by grafana-ds-convert"
+
+// Stamp controls how converted dashboards are named and marked
+type Stamp struct {
+	// Title renders the title of converted copies from a TitleData
+	Title *template.Template
+	// AddTags are added to converted dashboards
+	AddTags []string
+	// RemoveTags are removed from converted dashboards
+	RemoveTags []string
+	// Source notes the source dashboard and the conversion time in the
+	// description of converted dashboards, and links copies to their source
+	Source bool
+}
+
+// TitleData is what title templates are rendered with
+type TitleData struct {
+	// Title is the title of the source dashboard or library panel
+	Title string
+	// UID is the UID of the source dashboard or library panel
+	UID string
+	// Folder is the path of the destination folder
+	Folder string
+}
+
+// ParseTitleTemplate parses a title template such as "{{.Title}} [CAQL]"
+func ParseTitleTemplate(text string) (*template.Template, error) {
+	return template.New("title").Option("missingkey=error").Parse(text)
+}
+
+// copyTitle returns the title of the copy of src converted into folder
+func (g Grafana) copyTitle(src Dashboard, folder string) (string, error) {
+	return g.renderTitle(TitleData{Title: src.Title, UID: src.UID, Folder: folder})
+}
+
+// renderTitle renders the title template, also used to name library panels
+func (g Grafana) renderTitle(data TitleData) (string, error) {
+	if g.Stamp.Title == nil {
+		return data.Title, nil
+	}
+	var title strings.Builder
+	if err := g.Stamp.Title.Execute(&title, data); err != nil {
+		return "", fmt.Errorf("error rendering title: %w", err)
+	}
+	if strings.TrimSpace(title.String()) == "" {
+		return "", fmt.Errorf("title template renders an empty title")
+	}
+	return title.String(), nil
+}
+
+// stampBoard names and marks a converted dashboard. copied tells whether
+// newBoard is a copy of src rather than src itself.
+func (g Grafana) stampBoard(newBoard *Dashboard, src Dashboard, folder string, copied bool, now time.Time) error {
+	if copied {
+		title, err := g.copyTitle(src, folder)
+		if err != nil {
+			return err
+		}
+		newBoard.Title = title
+	}
+
+	var tags []string
+	for _, tag := range newBoard.Tags {
+		if !contains(g.Stamp.RemoveTags, tag) && !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range g.Stamp.AddTags {
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	newBoard.Tags = tags
+
+	if !g.Stamp.Source {
+		return nil
+	}
+	// drop the stamp of an earlier conversion
+	var lines []string
+	for _, line := range strings.Split(newBoard.Description, "\n") {
+		if !strings.HasPrefix(line, stampPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	stamp := fmt.Sprintf("%s at %s", stampPrefix, now.UTC().Format(time.RFC3339))
+	if copied && src.UID != "" {
+		stamp = fmt.Sprintf("%s from dashboard %s (%s) at %s", stampPrefix, src.Title, src.UID, now.UTC().Format(time.RFC3339))
+	}
+	newBoard.Description = strings.TrimSpace(strings.Join(append(lines, stamp), "\n"))
+	if copied && src.UID != "" {
+		// copies are regenerated from the source, so the link is not repeated
+		linkURL := g.dashboardURL(src.UID)
+		tooltip := "Converted from " + src.Title
+		newBoard.Links = append(newBoard.Links, sdk.Link{Title: "Source dashboard", Type: "link", URL: &linkURL, Tooltip: &tooltip})
+	}
+	return nil
+}
+
+// dashboardURL returns the path of a dashboard in the Grafana UI, including
+// the path Grafana is served under
+func (g Grafana) dashboardURL(uid string) string {
+	base := "/"
+	if u, err := url.Parse(g.baseURL); err == nil && u.Path != "" {
+		base = u.Path
+	}
+	return path.Join(base, "d", uid)
+}
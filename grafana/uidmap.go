@@ -0,0 +1,179 @@
+package grafana
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // used for naming, not security
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// UIDMap maps source dashboard UIDs to the UIDs of their converted copies.
+// Copies get a UID derived from the source UID unless the map already holds
+// one, so re-running a migration updates the same dashboards. The map can be
+// persisted to a file to keep track of what was converted.
+type UIDMap struct {
+	path       string
+	mu         sync.Mutex
+	dashboards map[string]string
+}
+
+// uidMapFile is the on disk layout of a UIDMap
+type uidMapFile struct {
+	Dashboards map[string]string `json:"dashboards"`
+}
+
+// NewUIDMap creates an empty in memory UID map
+func NewUIDMap() *UIDMap {
+	return &UIDMap{dashboards: make(map[string]string)}
+}
+
+// LoadUIDMap reads the UID map stored in path, a missing file is treated as
+// an empty map which Save will create
+func LoadUIDMap(path string) (*UIDMap, error) {
+	m := NewUIDMap()
+	m.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading UID map: %w", err)
+	}
+	var f uidMapFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing UID map %s: %w", path, err)
+	}
+	for src, dst := range f.Dashboards {
+		m.dashboards[src] = dst
+	}
+	return m, nil
+}
+
+// Save writes the map back to the file it was loaded from, it is a no-op for
+// in memory maps
+func (m *UIDMap) Save() error {
+	if m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	data, err := json.MarshalIndent(uidMapFile{Dashboards: m.dashboards}, "", "    ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error marshaling UID map: %w", err)
+	}
+	if err := os.WriteFile(m.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing UID map: %w", err)
+	}
+	return nil
+}
+
+// DestUID returns the UID of the converted copy of the source dashboard
+func (m *UIDMap) DestUID(srcUID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dst, ok := m.dashboards[srcUID]; ok {
+		return dst
+	}
+	return DeriveUID(srcUID)
+}
+
+// Lookup returns the UID of the converted copy of a dashboard if it has been
+// recorded
+func (m *UIDMap) Lookup(srcUID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dst, ok := m.dashboards[srcUID]
+	return dst, ok
+}
+
+// Set records the UID of the converted copy of a dashboard
+func (m *UIDMap) Set(srcUID, dstUID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dashboards[srcUID] = dstUID
+}
+
+// IsConverted reports whether uid is the UID of a converted copy, either a
+// derived one or one recorded in the map
+func (m *UIDMap) IsConverted(uid string) bool {
+	if derivedUIDRe.MatchString(uid) {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, dst := range m.dashboards {
+		if dst == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete forgets a source dashboard
+func (m *UIDMap) Delete(srcUID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dashboards, srcUID)
+}
+
+// Sources returns the recorded source UIDs in sorted order
+func (m *UIDMap) Sources() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srcs := make([]string, 0, len(m.dashboards))
+	for src := range m.dashboards {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	return srcs
+}
+
+// derivedUIDRe matches the UIDs returned by DeriveUID
+var derivedUIDRe = regexp.MustCompile(`^circ-[0-9a-f]{24}$`)
+
+// DeriveUID returns the deterministic UID of the converted copy of a source
+// dashboard, short enough for Grafana's 40 character limit
+func DeriveUID(srcUID string) string {
+	sum := sha1.Sum([]byte("grafana-ds-convert/" + srcUID)) //nolint:gosec
+	return "circ-" + hex.EncodeToString(sum[:])[:24]
+}
+
+// Prune deletes the converted copies of recorded dashboards whose source no
+// longer exists in Grafana, returning the UIDs of the deleted copies. Only
+// dashboards recorded in the UID map are considered.
+func (g Grafana) Prune(ctx context.Context) ([]string, error) {
+	var pruned []string
+	for _, src := range g.UIDMap.Sources() {
+		err := g.apiRequest(ctx, http.MethodGet, "api/dashboards/uid/"+src, nil, nil)
+		var apiErr *APIError
+		if err == nil {
+			continue
+		}
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return pruned, fmt.Errorf("error checking source dashboard %s: %w", src, err)
+		}
+		dst, _ := g.UIDMap.Lookup(src)
+		if g.DryRun {
+			logger.Printf(logger.LvlInfo, "Dry run, not pruning dashboard %s whose source %s is gone", dst, src)
+			pruned = append(pruned, dst)
+			continue
+		}
+		err = g.apiRequest(ctx, http.MethodDelete, "api/dashboards/uid/"+dst, nil, nil)
+		if err != nil && (!errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound) {
+			return pruned, fmt.Errorf("error deleting dashboard %s: %w", dst, err)
+		}
+		logger.Printf(logger.LvlInfo, "Pruned dashboard %s whose source %s is gone", dst, src)
+		g.UIDMap.Delete(src)
+		pruned = append(pruned, dst)
+	}
+	return pruned, nil
+}
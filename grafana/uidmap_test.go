@@ -0,0 +1,57 @@
+package grafana
+
+import "testing"
+
+// TestDeriveUID pins the derived UIDs: converted copies are found again by
+// them on later runs, so they must never change
+func TestDeriveUID(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"src7", "circ-9ac149d4fe1bd960fb0c703c"},
+		{"src8", "circ-36bddb8633a795e0e2748210"},
+		{"lib1", "circ-ee2c748cb29b43ed4739532a"},
+		{"", "circ-11df60a17561dcc39b02a0f1"},
+		{"a-very-long-source-uid-of-forty-chars-xx", "circ-2856b4f032c9368c6cf169b1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got := DeriveUID(tt.src)
+			if got != tt.want {
+				t.Errorf("DeriveUID(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+			if len(got) > 40 {
+				t.Errorf("DeriveUID(%q) = %q is longer than Grafana's 40 character limit", tt.src, got)
+			}
+		})
+	}
+}
+
+func TestUIDMapDestUID(t *testing.T) {
+	m := NewUIDMap()
+	m.Set("src7", "custom")
+	tests := []struct {
+		name      string
+		src       string
+		want      string
+		converted bool
+	}{
+		{"recorded copy", "src7", "custom", true},
+		{"derived copy", "src8", "circ-36bddb8633a795e0e2748210", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.DestUID(tt.src)
+			if got != tt.want {
+				t.Errorf("DestUID(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+			if m.IsConverted(got) != tt.converted {
+				t.Errorf("IsConverted(%q) = %v, want %v", got, !tt.converted, tt.converted)
+			}
+			if m.IsConverted(tt.src) {
+				t.Errorf("IsConverted(%q) = true for a source", tt.src)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/circonus/grafana-ds-convert/logger"
+)
+
+// DefaultVariableResultsLimit is the number of values converted variables
+// fetch when no limit is configured
+const DefaultVariableResultsLimit = 500
+
+// VariableResult records the conversion of a dashboard template variable
+type VariableResult struct {
+	Name        string   `json:"name"`
+	Original    string   `json:"original,omitempty"`
+	Query       string   `json:"query,omitempty"`
+	Notes       []string `json:"notes,omitempty"`
+	Unsupported string   `json:"unsupported,omitempty"`
+}
+
+// graphiteVariableQuery is a graphite variable query saved as an object, as newer
+// versions of the graphite datasource do
+type graphiteVariableQuery struct {
+	QueryType string `json:"queryType"`
+	Target    string `json:"target"`
+	Query     string `json:"query"`
+	// MetricFindQuery is set on queries already in the Circonus format
+	MetricFindQuery *string `json:"metricFindQuery"`
+}
+
+// circonusVariableQuery is the query of a Circonus datasource variable
+type circonusVariableQuery struct {
+	MetricFindQuery string `json:"metricFindQuery"`
+	QueryType       string `json:"queryType"`
+	ResultsLimit    int    `json:"resultsLimit"`
+	TagCategory     string `json:"tagCategory"`
+}
+
+// graphiteTagFuncRe matches the graphite variable queries listing tags or
+// tag values, which have no graphite style equivalent
+var graphiteTagFuncRe = regexp.MustCompile(`^\s*(tags|tag_values|seriesByTag)\s*\(`)
+
+// globChars are the characters making a graphite path node a glob
+const globChars = "*?[{"
+
+// parseVariableQuery returns the metric path of a graphite variable query,
+// saved either as a string or as an object
+func parseVariableQuery(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var q graphiteVariableQuery
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return "", fmt.Errorf("unrecognized query %s", raw)
+	}
+	switch {
+	case q.MetricFindQuery != nil:
+		return "", fmt.Errorf("query is already in the Circonus format")
+	case q.QueryType != "" && q.QueryType != "Default":
+		return "", fmt.Errorf("%s queries have no graphite style equivalent", q.QueryType)
+	case q.Target != "":
+		return q.Target, nil
+	}
+	return q.Query, nil
+}
+
+// convertVariables points the graphite query variables of a dashboard at the
+// Circonus datasource, turning their query into a graphite style metric
+// find. Everything Grafana does with the values found, such as regex
+// filtering and sorting, is left as it is.
+func (g Grafana) convertVariables(board *Dashboard, ds *datasourceSet, res *DashboardResult) {
+	for i := range board.Templating.List {
+		v := &board.Templating.List[i]
+		// other variable types have no datasource, rather than the default one
+		if v.Type != "query" && v.Type != "adhoc" {
+			continue
+		}
+		if !ds.isGraphite(v.Datasource) {
+			if ds.unknownDefault(v.Datasource) {
+				res.addSkipped("variable %s %s", v.Name, unknownDefaultReason)
+				logger.Printf(logger.LvlWarning, "Variable %s %s", v.Name, unknownDefaultReason)
+				continue
+			}
+			if g.Debug && v.Datasource != nil {
+				logger.Printf(logger.LvlDebug, "Skipping variable %s on datasource %s", v.Name, *v.Datasource)
+			}
+			continue
+		}
+		vres := &VariableResult{Name: v.Name}
+		res.Variables = append(res.Variables, vres)
+		if v.Type == "adhoc" {
+			vres.Unsupported = "ad hoc filters have no Circonus equivalent"
+			logger.Printf(logger.LvlWarning, "Variable %s: %s", v.Name, vres.Unsupported)
+			continue
+		}
+		if v.Query == nil || len(*v.Query) == 0 {
+			vres.Unsupported = "variable has no query"
+			logger.Printf(logger.LvlWarning, "Variable %s: %s", v.Name, vres.Unsupported)
+			continue
+		}
+		query, err := parseVariableQuery(*v.Query)
+		if err == nil && graphiteTagFuncRe.MatchString(query) {
+			err = fmt.Errorf("graphite tag queries have no graphite style equivalent")
+		}
+		vres.Original = query
+		if err != nil {
+			vres.Unsupported = err.Error()
+			logger.Printf(logger.LvlWarning, "Variable %s: %s", v.Name, vres.Unsupported)
+			continue
+		}
+
+		newQuery, _ := json.Marshal(circonusVariableQuery{
+			MetricFindQuery: query,
+			QueryType:       "graphite style",
+			ResultsLimit:    g.VariableResultsLimit,
+		})
+		if g.Debug {
+			logger.Printf(logger.LvlDebug, "variable query before: %s  object: %s", *v.Query, newQuery)
+		}
+		raw := json.RawMessage(newQuery)
+		v.Query = &raw
+		v.Datasource = ds.circonusRef(v.Datasource)
+		vres.Query = query
+
+		// the saved values came from graphite
+		if !v.Refresh.Flag && (v.Refresh.Value == nil || *v.Refresh.Value == 0) {
+			onLoad := int64(1)
+			v.Refresh.Value = &onLoad
+			vres.Notes = append(vres.Notes, "refreshed on dashboard load instead of never, the saved values came from graphite")
+		}
+		if v.IncludeAll && v.AllValue == "" {
+			// the graphite All value lists every value found, which the
+			// results limit can cut short, the glob the values were found
+			// with matches them all
+			nodes := strings.Split(query, ".")
+			last := nodes[len(nodes)-1]
+			switch {
+			case v.Regex != "":
+				vres.Notes = append(vres.Notes, "All lists the values found, the regex filter keeps it from being a glob")
+			case strings.ContainsAny(last, globChars) && !strings.Contains(last, "$"):
+				v.AllValue = last
+				vres.Notes = append(vres.Notes, fmt.Sprintf("All value set to %s", last))
+			}
+		}
+		res.VariablesChanged++
+	}
+}
@@ -0,0 +1,71 @@
+package grafana
+
+import (
+	"sync"
+
+	"github.com/circonus/grafana-ds-convert/circonus"
+)
+
+// DefaultWorkers is the number of dashboards fetched, converted or written
+// at once when no number is configured
+const DefaultWorkers = 4
+
+// runWorkers calls fn for every index below n from at most workers
+// goroutines at once, and returns once every call returned. Callers keep
+// what fn produces by index, so that it comes out in the order of the
+// input whatever the order the calls finish in.
+func runWorkers(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// translate translates a graphite query, waiting for one of the translation
+// slots of the run when the dashboards are converted concurrently
+func (g Grafana) translate(query string) (*circonus.Translation, error) {
+	if g.translations != nil {
+		g.translations <- struct{}{}
+		defer func() { <-g.translations }()
+	}
+	return g.CirconusClient.TranslateDetail(query)
+}
+
+// withTranslationSlots returns g bounding the translation requests made at
+// once to TranslateWorkers, unless a caller already did
+func (g Grafana) withTranslationSlots() Grafana {
+	if g.translations == nil && g.TranslateWorkers > 1 {
+		g.translations = make(chan struct{}, g.TranslateWorkers)
+	}
+	return g
+}
+
+// writeWorkers returns the number of dashboards written at once. Dashboards
+// written to a stream are written one at a time, in order.
+func (g Grafana) writeWorkers() int {
+	if _, ok := g.Sink.(WriterSink); ok {
+		return 1
+	}
+	return g.WriteWorkers
+}
@@ -31,17 +31,52 @@ type Circonus struct {
 
 // Grafana defines the Grafana specific configuration options
 type Grafana struct {
-	Host                string   `json:"host" toml:"host" yaml:"host"`
-	Port                string   `json:"port" toml:"port" yaml:"port"`
-	Path                string   `json:"path" toml:"path" yaml:"path"`
-	APIToken            string   `json:"api_token" toml:"api_token" yaml:"api_token"`
-	AnonymousAuth       bool     `json:"anonymous_auth" toml:"anonymous_auth" yaml:"anonymous_auth"`
-	TLS                 bool     `json:"secure" toml:"secure" yaml:"secure"`
-	SourceFolder        string   `json:"src_folder" toml:"src_folder" yaml:"src_folder"`
-	DestinationFolder   string   `json:"dest_folder" toml:"dest_folder" yaml:"dest_folder"`
-	GraphiteDatasources []string `json:"graphite_datasources" toml:"graphite_datasources" yaml:"graphite_datasources"`
-	CirconusDatasource  string   `json:"circonus_datasource" toml:"circonus_datasource" yaml:"circonus_datasource"`
-	NoAlerts            bool     `json:"no_alerts" toml:"no_alerts" yaml:"no_alerts"`
+	Host                   string   `json:"host" toml:"host" yaml:"host"`
+	Port                   string   `json:"port" toml:"port" yaml:"port"`
+	Path                   string   `json:"path" toml:"path" yaml:"path"`
+	APIToken               string   `json:"api_token" toml:"api_token" yaml:"api_token"`
+	AnonymousAuth          bool     `json:"anonymous_auth" toml:"anonymous_auth" yaml:"anonymous_auth"`
+	TLS                    bool     `json:"secure" toml:"secure" yaml:"secure"`
+	SourceFolder           string   `json:"src_folder" toml:"src_folder" yaml:"src_folder"`
+	DestinationFolder      string   `json:"dest_folder" toml:"dest_folder" yaml:"dest_folder"`
+	Recursive              bool     `json:"recursive" toml:"recursive" yaml:"recursive"`
+	CreateDestFolder       bool     `json:"create_dest_folder" toml:"create_dest_folder" yaml:"create_dest_folder"`
+	CopyFolderPermissions  bool     `json:"copy_folder_permissions" toml:"copy_folder_permissions" yaml:"copy_folder_permissions"`
+	CopyPermissions        bool     `json:"copy_permissions" toml:"copy_permissions" yaml:"copy_permissions"`
+	InPlace                bool     `json:"in_place" toml:"in_place" yaml:"in_place"`
+	CommitMessage          string   `json:"commit_message" toml:"commit_message" yaml:"commit_message"`
+	TitleTemplate          string   `json:"title_template" toml:"title_template" yaml:"title_template"`
+	AddTags                []string `json:"add_tags" toml:"add_tags" yaml:"add_tags"`
+	RemoveTags             []string `json:"remove_tags" toml:"remove_tags" yaml:"remove_tags"`
+	StampSource            bool     `json:"stamp_source" toml:"stamp_source" yaml:"stamp_source"`
+	VariableResultsLimit   int      `json:"variable_results_limit" toml:"variable_results_limit" yaml:"variable_results_limit"`
+	MigratePanels          bool     `json:"migrate_panels" toml:"migrate_panels" yaml:"migrate_panels"`
+	FetchWorkers           int      `json:"fetch_workers" toml:"fetch_workers" yaml:"fetch_workers"`
+	TranslateWorkers       int      `json:"translate_workers" toml:"translate_workers" yaml:"translate_workers"`
+	WriteWorkers           int      `json:"write_workers" toml:"write_workers" yaml:"write_workers"`
+	Tags                   []string `json:"tags" toml:"tags" yaml:"tags"`
+	ExcludeTags            []string `json:"exclude_tags" toml:"exclude_tags" yaml:"exclude_tags"`
+	TitleRegex             string   `json:"title_regex" toml:"title_regex" yaml:"title_regex"`
+	ExcludeTitleRegex      string   `json:"exclude_title_regex" toml:"exclude_title_regex" yaml:"exclude_title_regex"`
+	DashboardUIDs          []string `json:"dashboard_uids" toml:"dashboard_uids" yaml:"dashboard_uids"`
+	SearchQuery            string   `json:"search_query" toml:"search_query" yaml:"search_query"`
+	GraphiteDatasources    []string `json:"graphite_datasources" toml:"graphite_datasources" yaml:"graphite_datasources"`
+	CirconusDatasource     string   `json:"circonus_datasource" toml:"circonus_datasource" yaml:"circonus_datasource"`
+	CirconusDatasourceUID  string   `json:"circonus_datasource_uid" toml:"circonus_datasource_uid" yaml:"circonus_datasource_uid"`
+	GraphiteDatasourceUIDs []string `json:"graphite_datasource_uids" toml:"graphite_datasource_uids" yaml:"graphite_datasource_uids"`
+	DefaultDatasource      string   `json:"default_datasource" toml:"default_datasource" yaml:"default_datasource"`
+	NoAlerts               bool     `json:"no_alerts" toml:"no_alerts" yaml:"no_alerts"`
+	Alerts                 string   `json:"alerts" toml:"alerts" yaml:"alerts"`
+	RulesetDir             string   `json:"ruleset_dir" toml:"ruleset_dir" yaml:"ruleset_dir"`
+	DryRun                 bool     `json:"dry_run" toml:"dry_run" yaml:"dry_run"`
+	Output                 string   `json:"output" toml:"output" yaml:"output"`
+	OutputDir              string   `json:"output_dir" toml:"output_dir" yaml:"output_dir"`
+	ReportJSON             string   `json:"report_json" toml:"report_json" yaml:"report_json"`
+	ReportMarkdown         string   `json:"report_markdown" toml:"report_markdown" yaml:"report_markdown"`
+	OnFailure              string   `json:"on_failure" toml:"on_failure" yaml:"on_failure"`
+	UIDMapFile             string   `json:"uid_map_file" toml:"uid_map_file" yaml:"uid_map_file"`
+	Prune                  bool     `json:"prune" toml:"prune" yaml:"prune"`
+	JournalFile            string   `json:"journal_file" toml:"journal_file" yaml:"journal_file"`
 }
 
 // StatsdAggregations defines the statsd_aggregations options
@@ -53,17 +88,38 @@ type StatsdAggregations struct {
 
 // Validate validates that the required config keys are set
 func Validate() error {
+	if err := ValidateGrafana(); err != nil {
+		return err
+	}
+	if viper.GetString(keys.GrafanaDestFolder) == "" && !viper.GetBool(keys.GrafanaInPlace) {
+		return errors.New("must provide a destination Grafana folder")
+	}
+	if viper.GetString(keys.GrafanaSourceFolder) == "" && !selectorSet() {
+		return errors.New("must provide a source Grafana folder or a dashboard selector")
+	}
+	return nil
+}
+
+// ValidateGrafana validates that the keys needed to reach Grafana are set
+func ValidateGrafana() error {
 	if viper.GetString(keys.GrafanaAPIToken) == "" && !viper.GetBool(keys.GrafanaAnonymousAuth) {
 		return errors.New("Grafana API Token must be set")
 	} else if viper.GetString(keys.GrafanaHost) == "" {
 		return errors.New("Grafana host must be set")
 	}
-	if viper.GetString(keys.GrafanaSourceFolder) == "" || viper.GetString(keys.GrafanaDestFolder) == "" {
-		return errors.New("must provide source and destination Grafana folders")
-	}
 	return nil
 }
 
+// selectorSet reports whether any dashboard selector is configured
+func selectorSet() bool {
+	return len(viper.GetStringSlice(keys.GrafanaTags)) > 0 ||
+		len(viper.GetStringSlice(keys.GrafanaExcludeTags)) > 0 ||
+		viper.GetString(keys.GrafanaTitleRegex) != "" ||
+		viper.GetString(keys.GrafanaExcludeTitleRegex) != "" ||
+		len(viper.GetStringSlice(keys.GrafanaDashboardUIDs)) > 0 ||
+		viper.GetString(keys.GrafanaSearchQuery) != ""
+}
+
 // getConfig dumps the current configuration and returns it
 func getConfig() (*Config, error) {
 	var cfg Config
@@ -42,15 +42,120 @@ const (
 	// Grafana destination folder
 	GrafanaDestFolder = "grafana.dest_folder"
 
+	// Convert the folders below the source folder too
+	GrafanaRecursive = "grafana.recursive"
+
+	// Create the destination folder if it does not exist
+	GrafanaCreateDestFolder = "grafana.create_dest_folder"
+
+	// Copy the permissions of source folders onto the folders created for them
+	GrafanaCopyFolderPermissions = "grafana.copy_folder_permissions"
+
+	// Give converted dashboards the permissions of their source dashboard
+	GrafanaCopyPermissions = "grafana.copy_permissions"
+
+	// Convert dashboards in place instead of creating copies
+	GrafanaInPlace = "grafana.in_place"
+
+	// Version message of dashboards written to Grafana
+	GrafanaCommitMessage = "grafana.commit_message"
+
+	// Template for the title of converted dashboards
+	GrafanaTitleTemplate = "grafana.title_template"
+
+	// Tags added to converted dashboards
+	GrafanaAddTags = "grafana.add_tags"
+
+	// Tags removed from converted dashboards
+	GrafanaRemoveTags = "grafana.remove_tags"
+
+	// Note the source dashboard and conversion time on converted dashboards
+	GrafanaStampSource = "grafana.stamp_source"
+
+	// Number of values converted template variables fetch
+	GrafanaVariableResultsLimit = "grafana.variable_results_limit"
+
+	// Upgrade graph, singlestat and table-old panels of converted dashboards
+	GrafanaMigratePanels = "grafana.migrate_panels"
+
+	// Number of dashboards fetched from Grafana at once
+	GrafanaFetchWorkers = "grafana.fetch_workers"
+
+	// Number of dashboards converted, and of queries translated, at once
+	GrafanaTranslateWorkers = "grafana.translate_workers"
+
+	// Number of dashboards written at once
+	GrafanaWriteWorkers = "grafana.write_workers"
+
+	// Only convert dashboards having all of these tags
+	GrafanaTags = "grafana.tags"
+
+	// Skip dashboards having any of these tags
+	GrafanaExcludeTags = "grafana.exclude_tags"
+
+	// Only convert dashboards whose title matches this regular expression
+	GrafanaTitleRegex = "grafana.title_regex"
+
+	// Skip dashboards whose title matches this regular expression
+	GrafanaExcludeTitleRegex = "grafana.exclude_title_regex"
+
+	// Only convert the dashboards with these UIDs
+	GrafanaDashboardUIDs = "grafana.dashboard_uids"
+
+	// Only convert dashboards found by this Grafana search query
+	GrafanaSearchQuery = "grafana.search_query"
+
 	// Graphite data sources
 	GrafanaGraphiteDatasources = "grafana.graphite_datasources"
 
 	// Grafana Circonus Datasource name
 	GrafanaCirconusDatasource = "grafana.circonus_datasource"
 
+	// Grafana Circonus Datasource UID, used when converting offline
+	GrafanaCirconusDatasourceUID = "grafana.circonus_datasource_uid"
+
+	// Grafana Graphite Datasource UIDs, used when converting offline
+	GrafanaGraphiteDatasourceUIDs = "grafana.graphite_datasource_uids"
+
+	// Name or UID of the Grafana default datasource, used when converting offline
+	GrafanaDefaultDatasource = "grafana.default_datasource"
+
 	// Grafana dont populate alert bodies
 	GrafanaNoAlerts = "grafana.no_alerts"
 
+	// How legacy panel alerts are converted (keep|remove|ruleset)
+	GrafanaAlerts = "grafana.alerts"
+
+	// Directory Circonus ruleset definitions are written to
+	GrafanaRulesetDir = "grafana.ruleset_dir"
+
+	// Perform fetches and translations but do not write any dashboards
+	GrafanaDryRun = "grafana.dry_run"
+
+	// Where converted dashboards are written (grafana|stdout|dir)
+	GrafanaOutput = "grafana.output"
+
+	// Directory converted dashboards are written to when output is dir
+	GrafanaOutputDir = "grafana.output_dir"
+
+	// Path of the JSON conversion report
+	GrafanaReportJSON = "grafana.report_json"
+
+	// Path of the Markdown conversion report
+	GrafanaReportMarkdown = "grafana.report_markdown"
+
+	// What to do with a panel when a target fails to translate (keep|mixed|abort)
+	GrafanaOnFailure = "grafana.on_failure"
+
+	// File recording the UIDs of converted dashboards by source UID
+	GrafanaUIDMapFile = "grafana.uid_map_file"
+
+	// Delete converted dashboards whose source dashboard no longer exists
+	GrafanaPrune = "grafana.prune"
+
+	// File recording every dashboard written to Grafana, for rollbacks
+	GrafanaJournalFile = "grafana.journal_file"
+
 	//
 	// Circonus
 	//
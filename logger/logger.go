@@ -16,11 +16,12 @@ const (
 	LvlInfo    = LogLevel("INFO")
 )
 
-// PrintMarshal pretty prints a struct for use in debugging
+// PrintMarshal pretty prints a struct for use in debugging, it is written
+// to the log output so that it never mixes with converted output on stdout
 func PrintMarshal(level LogLevel, msg string, v interface{}) {
 	log.Printf("%s %s\n", level, msg)
 	pp, _ := json.MarshalIndent(v, "", "    ")
-	fmt.Println(string(pp))
+	fmt.Fprintln(log.Writer(), string(pp))
 }
 
 // PrintJSONBytes pretty prints a JSON byte array